@@ -0,0 +1,47 @@
+package timestream
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+)
+
+// WriteRecordsAPI is the part of the timestreamwrite client used by Writer.
+// *timestreamwrite.Client satisfies it.
+type WriteRecordsAPI interface {
+	WriteRecords(ctx context.Context, params *timestreamwrite.WriteRecordsInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.WriteRecordsOutput, error)
+}
+
+// WriteAPI is the subset of the timestreamwrite client used to manage databases and
+// tables and to write records. It leaves out endpoint discovery, batch load tasks
+// and resource tags. *timestreamwrite.Client satisfies it, and the timestreamtest
+// package provides in-memory implementations for tests.
+type WriteAPI interface {
+	WriteRecordsAPI
+	CreateDatabase(ctx context.Context, params *timestreamwrite.CreateDatabaseInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.CreateDatabaseOutput, error)
+	DescribeDatabase(ctx context.Context, params *timestreamwrite.DescribeDatabaseInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.DescribeDatabaseOutput, error)
+	ListDatabases(ctx context.Context, params *timestreamwrite.ListDatabasesInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.ListDatabasesOutput, error)
+	UpdateDatabase(ctx context.Context, params *timestreamwrite.UpdateDatabaseInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.UpdateDatabaseOutput, error)
+	DeleteDatabase(ctx context.Context, params *timestreamwrite.DeleteDatabaseInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.DeleteDatabaseOutput, error)
+	CreateTable(ctx context.Context, params *timestreamwrite.CreateTableInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.CreateTableOutput, error)
+	DescribeTable(ctx context.Context, params *timestreamwrite.DescribeTableInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.DescribeTableOutput, error)
+	ListTables(ctx context.Context, params *timestreamwrite.ListTablesInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.ListTablesOutput, error)
+	UpdateTable(ctx context.Context, params *timestreamwrite.UpdateTableInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.UpdateTableOutput, error)
+	DeleteTable(ctx context.Context, params *timestreamwrite.DeleteTableInput, optFns ...func(*timestreamwrite.Options)) (*timestreamwrite.DeleteTableOutput, error)
+}
+
+// QueryAPI is the part of the timestreamquery client used to run queries.
+// *timestreamquery.Client satisfies it, and the timestreamtest package provides
+// in-memory implementations for tests.
+type QueryAPI interface {
+	Query(ctx context.Context, params *timestreamquery.QueryInput, optFns ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error)
+	PrepareQuery(ctx context.Context, params *timestreamquery.PrepareQueryInput, optFns ...func(*timestreamquery.Options)) (*timestreamquery.PrepareQueryOutput, error)
+	CancelQuery(ctx context.Context, params *timestreamquery.CancelQueryInput, optFns ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error)
+}
+
+var (
+	_ WriteRecordsAPI = (*timestreamwrite.Client)(nil)
+	_ WriteAPI        = (*timestreamwrite.Client)(nil)
+	_ QueryAPI        = (*timestreamquery.Client)(nil)
+)
@@ -0,0 +1,171 @@
+package timestream
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+)
+
+// Encoder marshals values of a struct type T, whose tags are validated once by
+// NewEncoder. It is safe for concurrent use.
+//
+// Example usage, registering the types of a service at startup:
+//
+//	readings, err := NewEncoder[Reading](WithTimeUnit("us"))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	// ...
+//	record, err := readings.Encode(reading)
+type Encoder[T any] struct {
+	fields []taggedField
+	mode   MeasureMode
+	opts   marshalOptions
+}
+
+// NewEncoder checks that T is a struct, or a pointer to a struct, tagged as
+// described by Marshal, and returns an Encoder for it. Errors that Marshal reports
+// for every value of T, such as unknown tag options or missing required tags, are
+// reported here instead.
+func NewEncoder[T any](opts ...MarshalOption) (*Encoder[T], error) {
+	o := newMarshalOptions(opts)
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("invalid struct, %s is not a struct", t)
+	}
+	if _, ok := timeUnits[o.timeUnit]; o.timeUnit != "" && !ok {
+		return nil, fmt.Errorf("unsupported unit for timestamp: %s", o.timeUnit)
+	}
+
+	plan, mode, err := validatePlan(t, o.measureMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid struct, %w", err)
+	}
+	return &Encoder[T]{fields: plan.fields, mode: mode, opts: o}, nil
+}
+
+// Encode marshals v into a MULTI record. It fails for structs in SingleMeasure
+// mode, which yield a record per attribute, use EncodeAll for those.
+func (e *Encoder[T]) Encode(v T) (types.Record, error) {
+	if e.mode == SingleMeasure {
+		return types.Record{}, fmt.Errorf("cannot encode a single record in %s measure mode, use EncodeAll", e.mode)
+	}
+
+	records, err := e.encode(v)
+	if err != nil {
+		return types.Record{}, err
+	}
+	return records[0], nil
+}
+
+// EncodeAll marshals every value of vs, in order, reporting the errors of every
+// invalid value as Marshal does for slices.
+func (e *Encoder[T]) EncodeAll(vs []T) ([]types.Record, error) {
+	records := make([]types.Record, 0, len(vs))
+
+	var errs error
+	for i, v := range vs {
+		encoded, err := e.encode(v)
+		if err != nil {
+			errs = errors.Join(errs, &RowError{Index: i, Err: err})
+			continue
+		}
+
+		records = append(records, encoded...)
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return records, nil
+}
+
+func (e *Encoder[T]) encode(v T) ([]types.Record, error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil, fmt.Errorf("invalid struct, input is nil")
+		}
+		val = val.Elem()
+	}
+
+	if err := validateValues(val, e.fields); err != nil {
+		return nil, fmt.Errorf("invalid struct, %w", err)
+	}
+	return marshalValue(val, e.fields, e.mode, e.opts)
+}
+
+// Decoder unmarshals query outputs into values of type T, a struct tagged as for
+// Unmarshal or a map[string]any, whose tags are compiled once by NewDecoder. It is
+// safe for concurrent use.
+//
+// Example usage:
+//
+//	readings, err := NewDecoder[Reading]()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	// ...
+//	rows, err := readings.Decode(queryOutput)
+type Decoder[T any] struct {
+	t reflect.Type
+	// fields holds the tagged fields of a struct T, and is nil for a map[string]any.
+	fields []columnField
+}
+
+// NewDecoder checks that T is a struct with valid tags or a map[string]any, and
+// returns a Decoder for it.
+func NewDecoder[T any]() (*Decoder[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	switch {
+	case t == mapType:
+		return &Decoder[T]{t: t}, nil
+	case t.Kind() == reflect.Struct:
+		fields, err := columnFields(t)
+		if err != nil {
+			return nil, err
+		}
+		return &Decoder[T]{t: t, fields: fields}, nil
+	default:
+		return nil, fmt.Errorf("target must be a struct or a map[string]any, got %s", t)
+	}
+}
+
+// Decode unmarshals every row of the query output, checking the types of the
+// columns as Unmarshal does.
+func (d *Decoder[T]) Decode(queryOutput *timestreamquery.QueryOutput) ([]T, error) {
+	if queryOutput == nil {
+		return nil, fmt.Errorf("queryOutput is nil")
+	}
+	if err := validateRowDataLength(queryOutput); err != nil {
+		return nil, err
+	}
+
+	var bound []boundField
+	if d.t != mapType {
+		lookup := buildLookupTable(queryOutput.ColumnInfo)
+		if err := checkFieldTypes(d.t, d.fields, queryOutput.ColumnInfo, lookup); err != nil {
+			return nil, err
+		}
+		if len(queryOutput.Rows) > 0 {
+			var err error
+			if bound, err = bindFields(d.t, d.fields, lookup); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rows := make([]T, len(queryOutput.Rows))
+	for i, row := range queryOutput.Rows {
+		if err := unmarshalInto(row, queryOutput.ColumnInfo, reflect.ValueOf(&rows[i]).Elem(), bound); err != nil {
+			return nil, &RowError{Index: i, Err: err}
+		}
+	}
+	return rows, nil
+}
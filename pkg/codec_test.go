@@ -0,0 +1,220 @@
+package timestream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/EvergenEnergy/TimeSchema/pkg/timestreamtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEncoder(t *testing.T) {
+	type MissingMeasure struct {
+		Timestamp time.Time `timestream:"timestamp"`
+		Site      string    `timestream:"dimension,name=site"`
+		Power     float64   `timestream:"attribute,name=power"`
+	}
+	type IntDimension struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Site        int       `timestream:"dimension,name=site"`
+		Power       float64   `timestream:"attribute,name=power"`
+	}
+	type BadOption struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Site        string    `timestream:"dimension,nmae=site"`
+		Power       float64   `timestream:"attribute,name=power"`
+	}
+
+	tests := []struct {
+		name    string
+		newFunc func() error
+		wantErr string
+	}{
+		{
+			name:    "Accepts a valid struct",
+			newFunc: func() error { _, err := timestream.NewEncoder[writerReading](); return err },
+		},
+		{
+			name:    "Accepts a pointer to a valid struct",
+			newFunc: func() error { _, err := timestream.NewEncoder[*writerReading](); return err },
+		},
+		{
+			name:    "Rejects non-struct types",
+			newFunc: func() error { _, err := timestream.NewEncoder[map[string]any](); return err },
+			wantErr: "invalid struct, map[string]interface {} is not a struct",
+		},
+		{
+			name:    "Rejects missing required tags",
+			newFunc: func() error { _, err := timestream.NewEncoder[MissingMeasure](); return err },
+			wantErr: "invalid struct, missing required tag: measure",
+		},
+		{
+			name: "Accepts a missing measure in single measure mode",
+			newFunc: func() error {
+				_, err := timestream.NewEncoder[MissingMeasure](timestream.WithMeasureMode(timestream.SingleMeasure))
+				return err
+			},
+		},
+		{
+			name:    "Rejects unknown tag options",
+			newFunc: func() error { _, err := timestream.NewEncoder[BadOption](); return err },
+			wantErr: `invalid struct, invalid tag "dimension,nmae=site" on field Site of timestream_test.BadOption: unknown option "nmae=site"`,
+		},
+		{
+			name:    "Rejects dimensions that are not strings",
+			newFunc: func() error { _, err := timestream.NewEncoder[IntDimension](); return err },
+			wantErr: `invalid struct, invalid tag "dimension,name=site" on field Site of timestream_test.IntDimension: dimension field Site is not a string`,
+		},
+		{
+			name: "Rejects unknown time units",
+			newFunc: func() error {
+				_, err := timestream.NewEncoder[writerReading](timestream.WithTimeUnit("days"))
+				return err
+			},
+			wantErr: "unsupported unit for timestamp: days",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.newFunc()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	readings := newWriterReadings(3)
+	enc, err := timestream.NewEncoder[writerReading]()
+	assert.NoError(t, err)
+
+	t.Run("encodes like Marshal", func(t *testing.T) {
+		want, err := timestream.Marshal(readings)
+		assert.NoError(t, err)
+
+		got, err := enc.EncodeAll(readings)
+		assert.NoError(t, err)
+		if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(types.Record{}, types.Dimension{}, types.MeasureValue{})); diff != "" {
+			t.Errorf("EncodeAll() mismatch (-want +got):\n%s", diff)
+		}
+
+		record, err := enc.Encode(readings[1])
+		assert.NoError(t, err)
+		if diff := cmp.Diff(want[1], record, cmpopts.IgnoreUnexported(types.Record{}, types.Dimension{}, types.MeasureValue{})); diff != "" {
+			t.Errorf("Encode() mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("checks values", func(t *testing.T) {
+		_, err := enc.Encode(writerReading{MeasureName: "metrics"})
+		assert.EqualError(t, err, "invalid struct, field Timestamp of timestream_test.writerReading, column 'time': timestamp field is either not a time.Time or has a zero value")
+
+		_, err = enc.EncodeAll([]writerReading{readings[0], {Timestamp: now}})
+		assert.EqualError(t, err, "row 1: invalid struct, field MeasureName of timestream_test.writerReading, column 'measure_name': measureName field is either not a string or has a zero value")
+
+		ptrEnc, err := timestream.NewEncoder[*writerReading]()
+		assert.NoError(t, err)
+		_, err = ptrEnc.Encode(nil)
+		assert.EqualError(t, err, "invalid struct, input is nil")
+	})
+
+	t.Run("requires EncodeAll in single measure mode", func(t *testing.T) {
+		enc, err := timestream.NewEncoder[writerReading](timestream.WithMeasureMode(timestream.SingleMeasure))
+		assert.NoError(t, err)
+
+		_, err = enc.Encode(readings[0])
+		assert.Error(t, err)
+
+		records, err := enc.EncodeAll(readings)
+		assert.NoError(t, err)
+		assert.Len(t, records, len(readings))
+	})
+}
+
+func TestDecoder(t *testing.T) {
+	t.Run("validates the target type", func(t *testing.T) {
+		_, err := timestream.NewDecoder[iteratorRow]()
+		assert.NoError(t, err)
+		_, err = timestream.NewDecoder[map[string]any]()
+		assert.NoError(t, err)
+		_, err = timestream.NewDecoder[int]()
+		assert.EqualError(t, err, "target must be a struct or a map[string]any, got int")
+		_, err = timestream.NewDecoder[struct {
+			Site string `timestream:"omitempty"`
+		}]()
+		assert.Error(t, err)
+	})
+
+	t.Run("decodes structs and maps", func(t *testing.T) {
+		rows, err := timestream.NewDecoder[iteratorRow]()
+		assert.NoError(t, err)
+		got, err := rows.Decode(newPage(1, 2))
+		assert.NoError(t, err)
+		assert.Equal(t, []iteratorRow{{Site: "site-1", Power: 1}, {Site: "site-1", Power: 2}}, got)
+
+		maps, err := timestream.NewDecoder[map[string]any]()
+		assert.NoError(t, err)
+		gotMaps, err := maps.Decode(newPage(3))
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]any{{"site": "site-1", "power": int64(3)}}, gotMaps)
+
+		_, err = rows.Decode(nil)
+		assert.EqualError(t, err, "queryOutput is nil")
+	})
+
+	t.Run("reports columns the fields cannot hold", func(t *testing.T) {
+		dec, err := timestream.NewDecoder[struct {
+			Power time.Time `timestream:"name=power"`
+		}]()
+		assert.NoError(t, err)
+		_, err = dec.Decode(newPage(1))
+		var fieldErr *timestream.FieldError
+		if assert.ErrorAs(t, err, &fieldErr) {
+			assert.Equal(t, "power", fieldErr.Column)
+		}
+	})
+
+	t.Run("decodes what the encoder wrote", func(t *testing.T) {
+		emulator := timestreamtest.NewEmulator()
+		ctx := context.Background()
+		setupEmulator(t, emulator)
+
+		enc, err := timestream.NewEncoder[writerReading]()
+		assert.NoError(t, err)
+		dec, err := timestream.NewDecoder[writerReading]()
+		assert.NoError(t, err)
+
+		readings := newWriterReadings(3)
+		for i := range readings {
+			readings[i].Timestamp = readings[i].Timestamp.Truncate(time.Millisecond).UTC()
+		}
+		records, err := enc.EncodeAll(readings)
+		assert.NoError(t, err)
+		_, err = emulator.WriteRecords(ctx, &timestreamwrite.WriteRecordsInput{
+			DatabaseName: aws.String("db"),
+			TableName:    aws.String("readings"),
+			Records:      records,
+		})
+		assert.NoError(t, err)
+
+		out, err := emulator.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String(`SELECT * FROM "db"."readings" ORDER BY time`)})
+		assert.NoError(t, err)
+
+		got, err := dec.Decode(out)
+		assert.NoError(t, err)
+		assert.Equal(t, readings, got)
+	})
+}
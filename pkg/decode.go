@@ -0,0 +1,243 @@
+package timestream
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+)
+
+// Layouts of the textual values returned by Timestream queries.
+const (
+	timestampLayout = "2006-01-02 15:04:05.999999999"
+	dateLayout      = "2006-01-02"
+	timeOfDayLayout = "15:04:05.999999999"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// scalarTypeOf returns the scalar type of a column, or an empty type when the
+// column carries no type information.
+func scalarTypeOf(column types.ColumnInfo) types.ScalarType {
+	if column.Type == nil {
+		return ""
+	}
+	return column.Type.ScalarType
+}
+
+// checkScalarType reports whether values of a column of the given scalar type can
+// be decoded into a Go value of type t. Pointers and sql.Null*-style wrappers are
+// looked through, and types with a custom codec accept any column. Every column
+// can be decoded into a string, which receives the value as returned by Timestream.
+//
+// The accepted targets are:
+//   - VARCHAR: string
+//   - BIGINT and INTEGER: every int, uint and float width
+//   - DOUBLE: float32 and float64
+//   - BOOLEAN: bool
+//   - TIMESTAMP and DATE: time.Time
+//   - TIME: time.Time, on January 1st of year 0, and time.Duration since midnight
+//   - INTERVAL_DAY_TO_SECOND: time.Duration
+//   - INTERVAL_YEAR_TO_MONTH: every int width, as a number of months
+//   - UNKNOWN, the type of NULL literals: anything
+func checkScalarType(t reflect.Type, scalarType types.ScalarType) error {
+	t = indirectType(t)
+	if hasCustomCodec(t) || t.Kind() == reflect.String || scalarType == types.ScalarTypeUnknown {
+		return nil
+	}
+
+	var ok bool
+	switch scalarType {
+	case types.ScalarTypeBigint, types.ScalarTypeInteger:
+		ok = t != durationType && (isInt(t.Kind()) || isUint(t.Kind()) || isFloat(t.Kind()))
+	case types.ScalarTypeDouble:
+		ok = isFloat(t.Kind())
+	case types.ScalarTypeBoolean:
+		ok = t.Kind() == reflect.Bool
+	case types.ScalarTypeTimestamp, types.ScalarTypeDate:
+		ok = t == timeType
+	case types.ScalarTypeTime:
+		ok = t == timeType || t == durationType
+	case types.ScalarTypeIntervalDayToSecond:
+		ok = t == durationType
+	case types.ScalarTypeIntervalYearToMonth:
+		ok = t != durationType && isInt(t.Kind())
+	case types.ScalarTypeVarchar:
+	default:
+		return fmt.Errorf("unsupported column type %s", scalarType)
+	}
+
+	if !ok {
+		return fmt.Errorf("cannot decode %s column into %s", scalarType, t)
+	}
+	return nil
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+// decodeScalar parses data according to the scalar type of its column and stores
+// it into field, which must be a plain value as left by setFieldValue.
+func decodeScalar(field reflect.Value, scalarType types.ScalarType, data string) error {
+	if err := checkScalarType(field.Type(), scalarType); err != nil {
+		return err
+	}
+
+	if field.Kind() == reflect.String {
+		field.SetString(data)
+		return nil
+	}
+
+	switch scalarType {
+	case types.ScalarTypeBigint, types.ScalarTypeInteger:
+		return setNumber(field, data)
+	case types.ScalarTypeDouble:
+		floatValue, err := strconv.ParseFloat(data, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", field.Kind(), err)
+		}
+
+		field.SetFloat(floatValue)
+	case types.ScalarTypeBoolean:
+		boolValue, err := strconv.ParseBool(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse bool: %w", err)
+		}
+
+		field.SetBool(boolValue)
+	case types.ScalarTypeTimestamp, types.ScalarTypeDate:
+		layout := timestampLayout
+		if scalarType == types.ScalarTypeDate {
+			layout = dateLayout
+		}
+
+		parsedTime, err := time.Parse(layout, data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", scalarType, err)
+		}
+
+		field.Set(reflect.ValueOf(parsedTime))
+	case types.ScalarTypeTime:
+		parsedTime, err := time.Parse(timeOfDayLayout, data)
+		if err != nil {
+			return fmt.Errorf("failed to parse time of day: %w", err)
+		}
+
+		if field.Type() == durationType {
+			midnight := time.Date(parsedTime.Year(), parsedTime.Month(), parsedTime.Day(), 0, 0, 0, 0, time.UTC)
+			field.SetInt(int64(parsedTime.Sub(midnight)))
+		} else {
+			field.Set(reflect.ValueOf(parsedTime))
+		}
+	case types.ScalarTypeIntervalDayToSecond:
+		d, err := parseDayToSecond(data)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(d))
+	case types.ScalarTypeIntervalYearToMonth:
+		months, err := parseYearToMonth(data)
+		if err != nil {
+			return err
+		}
+		if field.OverflowInt(months) {
+			return fmt.Errorf("failed to parse interval: %d months overflows %s", months, field.Type())
+		}
+
+		field.SetInt(months)
+	case types.ScalarTypeUnknown:
+		return fmt.Errorf("unexpected value %q in a column of unknown type", data)
+	}
+	return nil
+}
+
+// setNumber parses an integer into an int, uint or float field, checking that it
+// fits the width of the field.
+func setNumber(field reflect.Value, data string) error {
+	switch {
+	case isInt(field.Kind()):
+		intValue, err := strconv.ParseInt(data, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", field.Kind(), err)
+		}
+
+		field.SetInt(intValue)
+	case isUint(field.Kind()):
+		uintValue, err := strconv.ParseUint(data, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", field.Kind(), err)
+		}
+
+		field.SetUint(uintValue)
+	default:
+		floatValue, err := strconv.ParseFloat(data, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", field.Kind(), err)
+		}
+
+		field.SetFloat(floatValue)
+	}
+	return nil
+}
+
+// parseDayToSecond parses an INTERVAL_DAY_TO_SECOND value such as
+// "1 02:03:04.000000000".
+func parseDayToSecond(data string) (time.Duration, error) {
+	sign, rest := intervalSign(data)
+	days, clock, ok := strings.Cut(rest, " ")
+	if !ok {
+		return 0, fmt.Errorf("failed to parse interval %q", data)
+	}
+
+	n, err := strconv.ParseInt(days, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse interval %q: %w", data, err)
+	}
+	parsedTime, err := time.Parse(timeOfDayLayout, clock)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse interval %q: %w", data, err)
+	}
+
+	midnight := time.Date(parsedTime.Year(), parsedTime.Month(), parsedTime.Day(), 0, 0, 0, 0, time.UTC)
+	return sign * (time.Duration(n)*24*time.Hour + parsedTime.Sub(midnight)), nil
+}
+
+// parseYearToMonth parses an INTERVAL_YEAR_TO_MONTH value such as "1-2" into a
+// number of months.
+func parseYearToMonth(data string) (int64, error) {
+	sign, rest := intervalSign(data)
+	years, months, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, fmt.Errorf("failed to parse interval %q", data)
+	}
+
+	y, err := strconv.ParseInt(years, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse interval %q: %w", data, err)
+	}
+	m, err := strconv.ParseInt(months, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse interval %q: %w", data, err)
+	}
+	return int64(sign) * (y*12 + m), nil
+}
+
+func intervalSign(data string) (time.Duration, string) {
+	if rest, ok := strings.CutPrefix(data, "-"); ok {
+		return -1, rest
+	}
+	return 1, data
+}
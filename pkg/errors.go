@@ -0,0 +1,76 @@
+package timestream
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TagError reports a `timestream` tag that cannot be used, such as an unknown
+// option or a role that does not fit the type of its field. It is found when a
+// struct type is first marshalled or unmarshalled, and reported for every value of
+// that type.
+type TagError struct {
+	// Type is the name of the marshalled or unmarshalled struct type.
+	Type string
+	// Field is the path to the field from Type, through embedded and inlined
+	// structs, e.g. "Inverter.Battery.Power".
+	Field string
+	Tag   string
+	Err   error
+}
+
+func (e *TagError) Error() string {
+	return fmt.Sprintf("invalid tag %q on field %s of %s: %v", e.Tag, e.Field, e.Type, e.Err)
+}
+
+func (e *TagError) Unwrap() error {
+	return e.Err
+}
+
+// FieldError reports a struct field whose value cannot be marshalled, or whose
+// column cannot be unmarshalled into it.
+type FieldError struct {
+	// Type is the name of the marshalled or unmarshalled struct type.
+	Type string
+	// Field is the path to the field from Type, as for TagError.
+	Field string
+	Tag   string
+	// Column is the query column the field is read from, or the column it is
+	// written to: "time", "measure_name", or the name of a dimension or attribute.
+	Column string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("field %s of %s, column '%s': %v", e.Field, e.Type, e.Column, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// RowError reports the element of a slice passed to Marshal or Encoder.EncodeAll,
+// or the row of a query output, that failed.
+type RowError struct {
+	// Index is the position of the element in the slice, or of the row in the
+	// query result. Rows are counted across pages by Query and QueryIterator.
+	Index int
+	Err   error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Index, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// typeName names a struct type in errors, without spelling out the fields of
+// anonymous structs.
+func typeName(t reflect.Type) string {
+	if t.Name() == "" {
+		return "anonymous struct"
+	}
+	return t.String()
+}
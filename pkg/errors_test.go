@@ -0,0 +1,161 @@
+package timestream_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/EvergenEnergy/TimeSchema/pkg/timestreamtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type errorBattery struct {
+	Serial string  `timestream:"dimension,name=serial"`
+	Power  float64 `timestream:"attribute,name=power"`
+}
+
+type errorReading struct {
+	Timestamp   time.Time    `timestream:"timestamp"`
+	MeasureName string       `timestream:"measure"`
+	Site        string       `timestream:"dimension,name=site"`
+	Battery     errorBattery `timestream:"inline,prefix=battery_"`
+}
+
+func TestMarshalErrors(t *testing.T) {
+	t.Run("TagError", func(t *testing.T) {
+		type BadTag struct {
+			Timestamp   time.Time `timestream:"timestamp"`
+			MeasureName string    `timestream:"measure"`
+			Battery     struct {
+				Serial string `timestream:"dimension,unit=days"`
+			} `timestream:"inline"`
+		}
+
+		_, err := timestream.Marshal(BadTag{})
+		var tagErr *timestream.TagError
+		if assert.ErrorAs(t, err, &tagErr) {
+			assert.Equal(t, "timestream_test.BadTag", tagErr.Type)
+			assert.Equal(t, "Battery.Serial", tagErr.Field)
+			assert.Equal(t, "dimension,unit=days", tagErr.Tag)
+			assert.EqualError(t, tagErr.Err, `unsupported unit "days"`)
+		}
+	})
+
+	t.Run("FieldError and RowError", func(t *testing.T) {
+		readings := []errorReading{
+			{Timestamp: now, MeasureName: "metrics", Site: "site-1", Battery: errorBattery{Serial: "B-1", Power: 1}},
+			{Timestamp: now, MeasureName: "metrics", Site: "site-1", Battery: errorBattery{Serial: "B-2", Power: math.NaN()}},
+		}
+
+		_, err := timestream.Marshal(readings)
+		var rowErr *timestream.RowError
+		if assert.ErrorAs(t, err, &rowErr) {
+			assert.Equal(t, 1, rowErr.Index)
+		}
+		var fieldErr *timestream.FieldError
+		if assert.ErrorAs(t, err, &fieldErr) {
+			assert.Equal(t, "timestream_test.errorReading", fieldErr.Type)
+			assert.Equal(t, "Battery.Power", fieldErr.Field)
+			assert.Equal(t, "attribute,name=power", fieldErr.Tag)
+			assert.Equal(t, "battery_power", fieldErr.Column)
+		}
+	})
+
+	t.Run("duplicate names point at the second field", func(t *testing.T) {
+		type Duplicate struct {
+			errorReading
+			Serial string `timestream:"dimension,name=battery_serial"`
+		}
+
+		_, err := timestream.Marshal(Duplicate{})
+		var tagErr *timestream.TagError
+		if assert.ErrorAs(t, err, &tagErr) {
+			assert.Equal(t, "Serial", tagErr.Field)
+		}
+	})
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	output := func(power string) *timestreamquery.QueryOutput {
+		return &timestreamquery.QueryOutput{
+			ColumnInfo: []types.ColumnInfo{
+				{Name: aws.String("site"), Type: &types.Type{ScalarType: types.ScalarTypeVarchar}},
+				{Name: aws.String("power"), Type: &types.Type{ScalarType: types.ScalarTypeBigint}},
+			},
+			Rows: []types.Row{
+				{Data: []types.Datum{{ScalarValue: aws.String("site-1")}, {ScalarValue: aws.String("1")}}},
+				{Data: []types.Datum{{ScalarValue: aws.String("site-1")}, {ScalarValue: aws.String(power)}}},
+			},
+		}
+	}
+
+	t.Run("decoding errors carry the row and the field", func(t *testing.T) {
+		var rows []struct {
+			Site  string `timestream:"name=site"`
+			Power int8   `timestream:"name=power"`
+		}
+		err := timestream.Unmarshal(output("300"), &rows)
+
+		var rowErr *timestream.RowError
+		if assert.ErrorAs(t, err, &rowErr) {
+			assert.Equal(t, 1, rowErr.Index)
+		}
+		var fieldErr *timestream.FieldError
+		if assert.ErrorAs(t, err, &fieldErr) {
+			assert.Equal(t, "anonymous struct", fieldErr.Type)
+			assert.Equal(t, "Power", fieldErr.Field)
+			assert.Equal(t, "power", fieldErr.Column)
+		}
+	})
+
+	t.Run("type mismatches carry the field", func(t *testing.T) {
+		var rows []struct {
+			Power bool `timestream:"name=power"`
+		}
+		err := timestream.Unmarshal(output("2"), &rows)
+
+		var fieldErr *timestream.FieldError
+		if assert.ErrorAs(t, err, &fieldErr) {
+			assert.Equal(t, "Power", fieldErr.Field)
+			assert.Equal(t, "power", fieldErr.Column)
+		}
+		assert.False(t, errors.As(err, new(*timestream.RowError)), "checked before any row")
+	})
+
+	t.Run("missing columns carry the field", func(t *testing.T) {
+		var rows []struct {
+			Missing string `timestream:"name=missing"`
+		}
+		err := timestream.Unmarshal(output("2"), &rows)
+
+		var fieldErr *timestream.FieldError
+		if assert.ErrorAs(t, err, &fieldErr) {
+			assert.Equal(t, "missing", fieldErr.Column)
+		}
+	})
+
+	t.Run("iterator rows are counted across pages", func(t *testing.T) {
+		emulator := timestreamtest.NewEmulator()
+		ctx := context.Background()
+		setupEmulator(t, emulator)
+
+		w := timestream.NewWriter(emulator, "db")
+		assert.NoError(t, w.Write(ctx, "readings", newWriterReadings(5)))
+		assert.NoError(t, w.Close(ctx))
+
+		_, err := timestream.Query[struct {
+			Power float32 `timestream:"name=power"`
+		}](ctx, emulator, `SELECT power * 1e38 AS power FROM "db"."readings" ORDER BY time`, timestream.WithPageSize(2))
+
+		var rowErr *timestream.RowError
+		if assert.ErrorAs(t, err, &rowErr) {
+			assert.Equal(t, 4, rowErr.Index)
+		}
+	})
+}
@@ -0,0 +1,8 @@
+package timestream
+
+// ResetTypeCaches empties the per-type plans built by Marshal and Unmarshal, so
+// that benchmarks can measure calls that compile them.
+func ResetTypeCaches() {
+	marshalPlans.reset()
+	columnPlans.reset()
+}
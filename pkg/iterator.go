@@ -0,0 +1,192 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+)
+
+// ErrTooManyRows is returned by Query and QueryIterator when a query yields more
+// rows than allowed by WithMaxRows.
+var ErrTooManyRows = errors.New("query returned too many rows")
+
+// QueryOption configures Query and NewQueryIterator.
+type QueryOption func(*queryOptions)
+
+type queryOptions struct {
+	pageSize int32
+	maxRows  int
+}
+
+// WithPageSize sets the number of rows requested per page through
+// QueryInput.MaxRows. Timestream picks the page size when it is not set.
+func WithPageSize(size int32) QueryOption {
+	return func(o *queryOptions) {
+		o.pageSize = size
+	}
+}
+
+// WithMaxRows limits the number of rows a query may return. Going over the limit
+// cancels the query and fails with ErrTooManyRows, which guards against loading an
+// unexpectedly large result into memory. Zero means no limit.
+func WithMaxRows(n int) QueryOption {
+	return func(o *queryOptions) {
+		o.maxRows = n
+	}
+}
+
+// Query runs the query, following NextToken until the result is exhausted, and
+// unmarshals every row into a T, which must be a struct tagged as for Unmarshal or
+// a map[string]any.
+//
+// Example usage:
+//
+//	readings, err := Query[Reading](ctx, client, `SELECT * FROM "db"."readings"`, WithMaxRows(10000))
+//	if err != nil {
+//	    // handle error
+//	}
+func Query[T any](ctx context.Context, client QueryAPI, query string, opts ...QueryOption) ([]T, error) {
+	it := NewQueryIterator[T](ctx, client, query, opts...)
+	defer it.Close()
+
+	var rows []T
+	for it.Next() {
+		rows = append(rows, it.Value())
+	}
+	return rows, it.Err()
+}
+
+// QueryIterator yields the rows of a query one by one, fetching the next page only
+// once the current one has been consumed, so that at most one page is held in memory.
+//
+// Example usage:
+//
+//	it := NewQueryIterator[Reading](ctx, client, query)
+//	defer it.Close()
+//	for it.Next() {
+//	    reading := it.Value()
+//	    // ...
+//	}
+//	if err := it.Err(); err != nil {
+//	    // handle error
+//	}
+type QueryIterator[T any] struct {
+	ctx     context.Context
+	client  QueryAPI
+	input   timestreamquery.QueryInput
+	opts    queryOptions
+	page    []T
+	pos     int
+	rows    int
+	queryID *string
+	started bool
+	done    bool
+	err     error
+}
+
+// NewQueryIterator returns an iterator over the rows of the query. The query is
+// sent on the first call to Next, and ctx applies to every page request.
+func NewQueryIterator[T any](ctx context.Context, client QueryAPI, query string, opts ...QueryOption) *QueryIterator[T] {
+	it := &QueryIterator[T]{
+		ctx:    ctx,
+		client: client,
+		input:  timestreamquery.QueryInput{QueryString: aws.String(query)},
+	}
+	for _, opt := range opts {
+		opt(&it.opts)
+	}
+	if it.opts.pageSize > 0 {
+		it.input.MaxRows = aws.Int32(it.opts.pageSize)
+	}
+	return it
+}
+
+// Next advances to the next row, fetching pages as needed. It returns false once
+// the rows are exhausted or an error occurred, which Err then reports.
+func (it *QueryIterator[T]) Next() bool {
+	for !it.done && it.pos >= len(it.page) {
+		if it.started && it.input.NextToken == nil {
+			it.done = true
+			break
+		}
+		if err := it.fetch(); err != nil {
+			it.fail(err)
+		}
+	}
+	if it.done {
+		return false
+	}
+
+	if err := it.ctx.Err(); err != nil {
+		it.fail(err)
+		return false
+	}
+
+	it.rows++
+	if it.opts.maxRows > 0 && it.rows > it.opts.maxRows {
+		it.fail(fmt.Errorf("%w: more than %d", ErrTooManyRows, it.opts.maxRows))
+		return false
+	}
+	it.pos++
+	return true
+}
+
+func (it *QueryIterator[T]) fetch() error {
+	if err := it.ctx.Err(); err != nil {
+		return err
+	}
+
+	input := it.input
+	out, err := it.client.Query(it.ctx, &input)
+	if err != nil {
+		return err
+	}
+	it.started = true
+	it.queryID = out.QueryId
+	it.input.NextToken = out.NextToken
+
+	var page []T
+	if err := Unmarshal(out, &page); err != nil {
+		// Count rows from the start of the query rather than of the page.
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			rowErr.Index += it.rows
+		}
+		return err
+	}
+	it.page, it.pos = page, 0
+	return nil
+}
+
+func (it *QueryIterator[T]) fail(err error) {
+	it.err, it.done, it.page = err, true, nil
+	it.Close()
+}
+
+// Value returns the current row. It is only valid after Next returned true.
+func (it *QueryIterator[T]) Value() T {
+	return it.page[it.pos-1]
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *QueryIterator[T]) Err() error {
+	return it.err
+}
+
+// Close stops the iteration and cancels the query when pages are still pending.
+// It is safe to call more than once.
+func (it *QueryIterator[T]) Close() error {
+	it.done, it.page = true, nil
+	if it.input.NextToken == nil || it.queryID == nil {
+		return nil
+	}
+
+	it.input.NextToken = nil
+	// The iteration context may already be cancelled, which must not prevent
+	// releasing the query.
+	_, err := it.client.CancelQuery(context.WithoutCancel(it.ctx), &timestreamquery.CancelQueryInput{QueryId: it.queryID})
+	return err
+}
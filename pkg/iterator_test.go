@@ -0,0 +1,157 @@
+package timestream_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/EvergenEnergy/TimeSchema/pkg/timestreamtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	"github.com/stretchr/testify/assert"
+)
+
+type iteratorRow struct {
+	Site  string `timestream:"name=site"`
+	Power int64  `timestream:"name=power"`
+}
+
+// newPage returns a query page with a row per power value.
+func newPage(powers ...int) *timestreamquery.QueryOutput {
+	out := &timestreamquery.QueryOutput{
+		ColumnInfo: []types.ColumnInfo{
+			{Name: aws.String("site"), Type: &types.Type{ScalarType: types.ScalarTypeVarchar}},
+			{Name: aws.String("power"), Type: &types.Type{ScalarType: types.ScalarTypeBigint}},
+		},
+	}
+	for _, p := range powers {
+		out.Rows = append(out.Rows, types.Row{Data: []types.Datum{
+			{ScalarValue: aws.String("site-1")},
+			{ScalarValue: aws.String(strconv.Itoa(p))},
+		}})
+	}
+	return out
+}
+
+func setupEmulator(t *testing.T, emulator *timestreamtest.Emulator) {
+	t.Helper()
+	ctx := context.Background()
+	_, err := emulator.CreateDatabase(ctx, &timestreamwrite.CreateDatabaseInput{DatabaseName: aws.String("db")})
+	assert.NoError(t, err)
+	_, err = emulator.CreateTable(ctx, &timestreamwrite.CreateTableInput{DatabaseName: aws.String("db"), TableName: aws.String("readings")})
+	assert.NoError(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	client := timestreamtest.NewFakeQueryClient(newPage(1, 2), newPage(), newPage(3))
+
+	rows, err := timestream.Query[iteratorRow](context.Background(), client, "SELECT site, power FROM db.t", timestream.WithPageSize(2))
+	assert.NoError(t, err)
+	assert.Equal(t, []iteratorRow{{"site-1", 1}, {"site-1", 2}, {"site-1", 3}}, rows)
+
+	requests := client.QueryRequests()
+	if assert.Len(t, requests, 3, "empty pages are followed") {
+		assert.Equal(t, aws.Int32(2), requests[0].MaxRows)
+		assert.Nil(t, requests[0].NextToken)
+		assert.Equal(t, aws.String("2"), requests[2].NextToken)
+	}
+}
+
+func TestQueryEmulated(t *testing.T) {
+	emulator := timestreamtest.NewEmulator()
+	ctx := context.Background()
+	setupEmulator(t, emulator)
+
+	w := timestream.NewWriter(emulator, "db")
+	assert.NoError(t, w.Write(ctx, "readings", newWriterReadings(25)))
+	assert.NoError(t, w.Close(ctx))
+
+	rows, err := timestream.Query[struct {
+		Device string  `timestream:"name=device"`
+		Power  float64 `timestream:"name=power"`
+	}](ctx, emulator, `SELECT device, power FROM "db"."readings" ORDER BY power`, timestream.WithPageSize(10))
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 25) {
+		assert.Equal(t, "device-0", rows[24].Device)
+		assert.Equal(t, 24.0, rows[24].Power)
+	}
+}
+
+func TestQueryMaxRows(t *testing.T) {
+	client := timestreamtest.NewFakeQueryClient(newPage(1, 2), newPage(3, 4), newPage(5))
+
+	rows, err := timestream.Query[iteratorRow](context.Background(), client, "SELECT site, power FROM db.t", timestream.WithMaxRows(3))
+	assert.ErrorIs(t, err, timestream.ErrTooManyRows)
+	assert.Len(t, rows, 3)
+
+	requests := client.Requests()
+	if assert.Len(t, requests, 3, "the third page is never fetched") {
+		assert.IsType(t, &timestreamquery.CancelQueryInput{}, requests[2])
+	}
+
+	rows, err = timestream.Query[iteratorRow](context.Background(), client, "SELECT site, power FROM db.t", timestream.WithMaxRows(5))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 5)
+}
+
+func TestQueryIterator(t *testing.T) {
+	t.Run("yields rows page by page", func(t *testing.T) {
+		client := timestreamtest.NewFakeQueryClient(newPage(1, 2), newPage(3))
+		it := timestream.NewQueryIterator[iteratorRow](context.Background(), client, "SELECT site, power FROM db.t")
+		defer it.Close()
+
+		assert.True(t, it.Next())
+		assert.Equal(t, int64(1), it.Value().Power)
+		assert.Len(t, client.QueryRequests(), 1, "pages are fetched lazily")
+		assert.True(t, it.Next())
+		assert.True(t, it.Next())
+		assert.Equal(t, int64(3), it.Value().Power)
+		assert.False(t, it.Next())
+		assert.False(t, it.Next())
+		assert.NoError(t, it.Err())
+		assert.Len(t, client.Requests(), 2)
+	})
+
+	t.Run("stops on cancellation", func(t *testing.T) {
+		client := timestreamtest.NewFakeQueryClient(newPage(1, 2), newPage(3))
+		ctx, cancel := context.WithCancel(context.Background())
+		it := timestream.NewQueryIterator[iteratorRow](ctx, client, "SELECT site, power FROM db.t")
+		defer it.Close()
+
+		assert.True(t, it.Next())
+		cancel()
+		assert.False(t, it.Next())
+		assert.ErrorIs(t, it.Err(), context.Canceled)
+
+		requests := client.Requests()
+		if assert.Len(t, requests, 2, "the pending query is cancelled") {
+			assert.Equal(t, aws.String("fake-query"), requests[1].(*timestreamquery.CancelQueryInput).QueryId)
+		}
+	})
+
+	t.Run("reports query errors", func(t *testing.T) {
+		client := timestreamtest.NewFakeQueryClient(newPage(1), newPage(2))
+		client.FailWith(nil, errors.New("boom"))
+		it := timestream.NewQueryIterator[iteratorRow](context.Background(), client, "SELECT site, power FROM db.t")
+		defer it.Close()
+
+		assert.True(t, it.Next())
+		assert.False(t, it.Next())
+		assert.EqualError(t, it.Err(), "boom")
+	})
+
+	t.Run("reports unmarshal errors", func(t *testing.T) {
+		client := timestreamtest.NewFakeQueryClient(newPage(1))
+		it := timestream.NewQueryIterator[struct {
+			Missing string `timestream:"name=missing"`
+		}](context.Background(), client, "SELECT site, power FROM db.t")
+		defer it.Close()
+
+		assert.False(t, it.Next())
+		assert.Error(t, it.Err())
+	})
+}
@@ -8,7 +8,9 @@ package timestream
 import (
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -26,27 +28,114 @@ const (
 	attribute requiredField = "attribute"
 )
 
+// MarshalOption configures the behaviour of Marshal.
+type MarshalOption func(*marshalOptions)
+
+type marshalOptions struct {
+	timeUnit    string
+	measureMode MeasureMode
+}
+
+// MeasureMode selects the Timestream data model Marshal writes records for.
+type MeasureMode string
+
+const (
+	// MultiMeasure writes one MULTI record per struct, holding every attribute as a
+	// measure value. This is the default.
+	MultiMeasure MeasureMode = "multi"
+	// SingleMeasure writes one record per attribute, named after the attribute and
+	// holding its value in MeasureValue, for tables using the single-measure model.
+	SingleMeasure MeasureMode = "single"
+)
+
+// modeTagPrefix marks a blank field selecting the measure mode of its struct,
+// e.g. a `_ struct{}` field tagged with `timestream:"mode=single"`.
+const modeTagPrefix = "mode="
+
+// WithTimeUnit sets the precision of the record timestamp for timestamp fields that do
+// not specify a unit in their tag. Supported units are "s", "ms", "us" and "ns", and the
+// matching types.TimeUnit is set on every record. Without this option, timestamps are
+// written in milliseconds and the record TimeUnit is left to the Timestream default.
+func WithTimeUnit(unit string) MarshalOption {
+	return func(o *marshalOptions) {
+		o.timeUnit = unit
+	}
+}
+
+// WithMeasureMode sets the measure mode of structs that do not select one
+// themselves through a `timestream:"mode=..."` field.
+func WithMeasureMode(mode MeasureMode) MarshalOption {
+	return func(o *marshalOptions) {
+		o.measureMode = mode
+	}
+}
+
+func newMarshalOptions(opts []MarshalOption) marshalOptions {
+	var o marshalOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// inlineTag marks a nested struct field whose tagged fields are marshalled as
+// if they were declared on the parent struct.
+const inlineTag = "inline"
+
 // Marshal takes a struct as input and transforms it into a types.Record
 // compatible with AWS Timestream. The struct fields should be annotated
 // with 'timestream' tags to indicate how they map to the Timestream data model.
 //
 // Supported tag options:
 //   - "timestamp": Indicates the field representing the timestamp for the record.
-//     The field must be of type time.Time and non-zero.
+//     The field must be of type time.Time and non-zero. It is written in milliseconds
+//     unless a unit is given, either through WithTimeUnit or in the tag, e.g.,
+//     `timestream:"timestamp,unit=us"`. When a unit is given, the matching TimeUnit is
+//     set on the record.
 //   - "measure": Represents the measure name. It must be a non-empty string.
 //   - "dimension": Used for dimensions in Timestream. Multiple dimensions are supported.
 //     Optionally, a 'name' can be specified (e.g., `timestream:"dimension,name=customName"`).
 //   - "attribute": Represents measure values. Multiple measure values are supported.
-//     The field can be of a primitive type (string, int, float).
-//     For `time.Time` fields, you can specify the unit of time (s for seconds, ms for milliseconds, ns for nanoseconds)
+//     The field can be of a primitive type (string, bool, signed or unsigned int, float).
+//     Booleans are written as BOOLEAN and integers as BIGINT. Floats are written with the
+//     shortest representation that round-trips, or with N significant digits when a
+//     'precision' is given (e.g., `timestream:"attribute,name=price,precision=6"`).
+//     NaN and infinite floats are rejected.
+//     For `time.Time` fields, you can specify the unit of time (s for seconds, ms for milliseconds,
+//     us for microseconds, ns for nanoseconds)
 //     to format the timestamp accordingly, e.g., `timestream:"attribute,name=timestamp,unit=ms"`.
+//     Types implementing TimestreamMarshaler choose their own measure value type, and
+//     types implementing encoding.TextMarshaler are written as VARCHAR.
 //   - "omitempty": This tag can only be applied to string fields. Fields with this tag
 //     are omitted if they are empty strings. For non-string fields, this tag will
 //     cause an error during marshalling. It is intended to reduce data size and handle
 //     optional string fields gracefully.
+//   - "mode": Selects the measure mode of the struct, overriding WithMeasureMode. It is set
+//     on a blank `_ struct{}` field, e.g., `timestream:"mode=single"`, and is reported as an
+//     error on any other field. In MultiMeasure mode,
+//     the default, a MULTI record holding every attribute is written. In SingleMeasure mode
+//     one record is written per attribute, named after it, and the "measure" tag is optional
+//     and unused.
+//   - "inline": Applies to nested struct fields. The tagged fields of the nested struct
+//     are marshalled as if they were declared on the parent. An optional 'prefix' is
+//     prepended to the names of the nested dimensions and attributes,
+//     e.g., `timestream:"inline,prefix=battery_"`.
+//
+// Pointer fields and sql.Null*-style wrappers (a struct holding a value field and a
+// 'Valid' bool, such as sql.NullFloat64) are supported for every tag. A nil pointer or an
+// invalid wrapper is skipped for dimensions and attributes, and rejected for the
+// timestamp and the measure.
+//
+// Embedded structs are walked the same way as inlined ones, unless they carry a tag of
+// their own. Dimensions, attributes, the timestamp and the measure may be declared at any
+// depth, and names must be unique across the flattened struct.
 //
 // The function returns an error if the input is not a struct,
 // does not meet the tagging requirements, or if any fields are of unsupported types.
+// Invalid tags are reported as a *TagError and invalid values as a *FieldError,
+// naming the struct type, field path and tag. For slices, the error of each failing
+// element is wrapped in a *RowError holding its index. All can be retrieved with
+// errors.As.
 //
 // Examples of struct field tags and their meanings:
 //
@@ -61,15 +150,15 @@ const (
 // Note: This function uses reflection to inspect struct fields. Fields with unsupported
 // types or incorrect tagging will result in an error.
 //
-// The function is designed to handle common use cases efficiently, but complex structs
-// with deeply nested structures or a large number of fields may impact performance.
+// Tags are parsed and validated once per struct type, and the result is cached for
+// the lifetime of the program, so that marshalling a slice only inspects the values
+// of its elements. Recursive embedded struct pointers are reported as a cycle.
 // Limitations:
 // - The function does not support encoding of channel, complex, function values,
 // or cyclic data structures. Attempting to encode such values will result in an error.
-// - The function currently only supports basic types and time.Time for measure values.
-// Custom types or types implementing specific interfaces are not currently supported.
-// - There is a limitation in the depth of struct traversal; only the first level of fields
-// is considered. Nested structs or embedded structs are not recursively processed.
+// - Beyond basic types and time.Time, measure values and dimensions must implement
+// TimestreamMarshaler or encoding.TextMarshaler.
+// - Named nested structs are only traversed when tagged with "inline"; untagged ones are ignored.
 //
 // It's important to ensure that structs passed to Marshal are well-formed according to
 // the expectations of AWS Timestream data model, particularly regarding the types and
@@ -91,7 +180,9 @@ const (
 //
 // This function is part of a package designed to simplify the interaction with AWS Timestream,
 // making the process of data preparation more straightforward and less error-prone.
-func Marshal(v any) ([]types.Record, error) {
+func Marshal(v any, opts ...MarshalOption) ([]types.Record, error) {
+	o := newMarshalOptions(opts)
+
 	val := reflect.ValueOf(v)
 	if val.Kind() == reflect.Slice {
 		var records []types.Record
@@ -99,13 +190,13 @@ func Marshal(v any) ([]types.Record, error) {
 		var errs error
 
 		for i := 0; i < val.Len(); i++ {
-			record, err := marshalSingle(val.Index(i).Interface())
+			record, err := marshalSingle(val.Index(i).Interface(), o)
 			if err != nil {
-				errs = errors.Join(errs, err)
+				errs = errors.Join(errs, &RowError{Index: i, Err: err})
 				continue
 			}
 
-			records = append(records, record)
+			records = append(records, record...)
 		}
 		if errs != nil {
 			return nil, errs
@@ -113,61 +204,106 @@ func Marshal(v any) ([]types.Record, error) {
 		return records, nil
 	}
 
-	record, err := marshalSingle(v)
-	if err != nil {
-		return nil, err
-	}
-	return []types.Record{record}, err
+	return marshalSingle(v, o)
 }
 
-func marshalSingle(v any) (types.Record, error) {
-	val, err := validateRequiredFields(v)
+func marshalSingle(v any, o marshalOptions) ([]types.Record, error) {
+	val, fields, mode, err := validateRequiredFields(v, o.measureMode)
 	if err != nil {
-		return types.Record{}, fmt.Errorf("invalid struct, %w", err)
+		return nil, fmt.Errorf("invalid struct, %w", err)
 	}
+	return marshalValue(val, fields, mode, o)
+}
 
+// marshalValue turns a validated struct value into its records.
+func marshalValue(val reflect.Value, fields []taggedField, mode MeasureMode, o marshalOptions) ([]types.Record, error) {
 	var record types.Record
 
-	for i := 0; i < val.NumField(); i++ {
-		tag, ok := val.Type().Field(i).Tag.Lookup("timestream")
-		if !ok {
-			continue
+	for _, f := range fields {
+		if err := handleRecord(&record, f, fieldValue(val, f.index), o); err != nil {
+			return nil, f.fieldError(val.Type(), err)
 		}
+	}
 
-		err = handleRecord(&record, val, i, tag)
-		if err != nil {
-			return types.Record{}, err
-		}
+	if mode == SingleMeasure {
+		return splitSingleMeasure(record), nil
 	}
-	return record, nil
+
+	record.MeasureValueType = types.MeasureValueTypeMulti
+	return []types.Record{record}, nil
 }
 
-func handleRecord(record *types.Record, val reflect.Value, i int, tag string) error {
-	field := val.Type().Field(i)
-	tagParts := strings.Split(tag, ",")
-	tagName, omitempty := extractTagName(field, tagParts)
-	tagType := requiredField(tagParts[0])
+// splitSingleMeasure turns the measure values of a MULTI record into one
+// single-measure record each, sharing the time and dimensions of the original.
+func splitSingleMeasure(record types.Record) []types.Record {
+	records := make([]types.Record, 0, len(record.MeasureValues))
+	for _, mv := range record.MeasureValues {
+		records = append(records, types.Record{
+			Dimensions:       slices.Clone(record.Dimensions),
+			Time:             record.Time,
+			TimeUnit:         record.TimeUnit,
+			MeasureName:      mv.Name,
+			MeasureValue:     mv.Value,
+			MeasureValueType: mv.Type,
+		})
+	}
+	return records
+}
+
+func handleRecord(record *types.Record, f taggedField, fieldValue reflect.Value, o marshalOptions) error {
+	tagName := f.name
 
-	switch tagType {
+	value, ok := indirect(fieldValue)
+	if !ok {
+		// nil pointers and invalid nullable values are skipped, validation has
+		// already rejected them for the timestamp and the measure.
+		return nil
+	}
+
+	switch f.tag.kind {
 	case timestamp:
-		timestamp, ok := val.Field(i).Interface().(time.Time)
+		timestamp, ok := value.Interface().(time.Time)
 		if !ok {
 			return fmt.Errorf("timestamp field is not a time.Time")
 		}
 
-		formattedTime := fmt.Sprintf("%d", timestamp.UnixMilli())
+		unit := f.tag.unit
+		if unit == "" {
+			unit = o.timeUnit
+		}
+		if unit == "" {
+			formattedTime := fmt.Sprintf("%d", timestamp.UnixMilli())
+			record.Time = &formattedTime
+			break
+		}
+
+		timeUnit, ok := timeUnits[unit]
+		if !ok {
+			return fmt.Errorf("unsupported unit for timestamp: %s", unit)
+		}
+		formattedTime, err := formatTime(timestamp, unit)
+		if err != nil {
+			return err
+		}
 		record.Time = &formattedTime
+		record.TimeUnit = timeUnit
 	case measure:
-		measureName := val.Field(i).Interface().(string)
+		measureName := value.String()
 		record.MeasureName = &measureName
 	case dimension:
-		dimensionName := val.Field(i).Interface().(string)
-		record.Dimensions = append(record.Dimensions, types.Dimension{Name: &tagName, Value: aws.String(dimensionName)})
+		_, dimensionValue, custom, err := marshalCustom(value)
+		if err != nil {
+			return err
+		}
+		if !custom {
+			dimensionValue = value.String()
+		}
+		record.Dimensions = append(record.Dimensions, types.Dimension{Name: &tagName, Value: aws.String(dimensionValue)})
 	case attribute:
-		if omitempty && isZeroValue(val.Field(i)) {
+		if f.tag.omitEmpty && isZeroValue(value) {
 			return nil
 		}
-		measureValue, err := handleMeasureValue(tagName, tag, val.Field(i))
+		measureValue, err := handleMeasureValue(tagName, f.tag, value)
 		if err != nil {
 			return err
 		}
@@ -176,11 +312,21 @@ func handleRecord(record *types.Record, val reflect.Value, i int, tag string) er
 	return nil
 }
 
-func handleMeasureValue(tagName, tag string, fieldValue reflect.Value) (types.MeasureValue, error) {
+func handleMeasureValue(tagName string, tag fieldTag, fieldValue reflect.Value) (types.MeasureValue, error) {
 	var measureValue types.MeasureValue
 
 	measureValue.Name = aws.String(tagName)
 
+	valueType, value, custom, err := marshalCustom(fieldValue)
+	if err != nil {
+		return types.MeasureValue{}, err
+	}
+	if custom {
+		measureValue.Type = valueType
+		measureValue.Value = aws.String(value)
+		return measureValue, nil
+	}
+
 	switch fieldValue.Kind() {
 	case reflect.Struct:
 		// Check specifically for time.Time
@@ -189,27 +335,17 @@ func handleMeasureValue(tagName, tag string, fieldValue reflect.Value) (types.Me
 			if !ok {
 				return types.MeasureValue{}, fmt.Errorf("field is not a time.Time")
 			}
-			// Extract unit from tag, default to milliseconds
-			unit := "s"
-			tagParts := strings.Split(tag, ",")
-			for _, part := range tagParts {
-				if strings.HasPrefix(part, "unit=") {
-					unit = strings.TrimPrefix(part, "unit=")
-					break
-				}
+			// Extract unit from tag, default to seconds
+			unit := tag.unit
+			if unit == "" {
+				unit = "s"
 			}
 
-			// Convert time based on unit
-			switch unit {
-			case "s":
-				measureValue.Value = aws.String(strconv.FormatInt(timeValue.Unix(), 10))
-			case "ms":
-				measureValue.Value = aws.String(strconv.FormatInt(timeValue.UnixMilli(), 10))
-			case "ns":
-				measureValue.Value = aws.String(strconv.FormatInt(timeValue.UnixNano(), 10))
-			default:
-				return types.MeasureValue{}, fmt.Errorf("unsupported unit for time: %s", unit)
+			formattedTime, err := formatTime(timeValue, unit)
+			if err != nil {
+				return types.MeasureValue{}, err
 			}
+			measureValue.Value = aws.String(formattedTime)
 
 			measureValue.Type = types.MeasureValueTypeTimestamp
 			return measureValue, nil
@@ -226,12 +362,27 @@ func handleMeasureValue(tagName, tag string, fieldValue reflect.Value) (types.Me
 		}
 
 		measureValue.Type = types.MeasureValueTypeVarchar
+	case reflect.Bool:
+		measureValue.Value = aws.String(strconv.FormatBool(fieldValue.Bool()))
+		measureValue.Type = types.MeasureValueTypeBoolean
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		formatInt := strconv.FormatInt(fieldValue.Int(), 10)
 		measureValue.Value = &formatInt
 		measureValue.Type = types.MeasureValueTypeBigint
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		// BIGINT is signed, larger values would be rejected by Timestream.
+		if fieldValue.Uint() > math.MaxInt64 {
+			return types.MeasureValue{}, fmt.Errorf("value %d of %s overflows BIGINT", fieldValue.Uint(), tagName)
+		}
+		formatUint := strconv.FormatUint(fieldValue.Uint(), 10)
+		measureValue.Value = &formatUint
+		measureValue.Type = types.MeasureValueTypeBigint
 	case reflect.Float32, reflect.Float64:
-		measureValue.Value = aws.String(fmt.Sprintf("%f", fieldValue.Float()))
+		formatFloat, err := formatFloat(fieldValue.Float(), fieldValue.Type().Bits(), tag.precision)
+		if err != nil {
+			return types.MeasureValue{}, fmt.Errorf("invalid value for %s: %w", tagName, err)
+		}
+		measureValue.Value = &formatFloat
 		measureValue.Type = types.MeasureValueTypeDouble
 	default:
 		return types.MeasureValue{}, fmt.Errorf("unsupported type for measureValue")
@@ -240,6 +391,40 @@ func handleMeasureValue(tagName, tag string, fieldValue reflect.Value) (types.Me
 	return measureValue, nil
 }
 
+// timeUnits maps the supported unit tag options to their Timestream time unit.
+var timeUnits = map[string]types.TimeUnit{
+	"s":  types.TimeUnitSeconds,
+	"ms": types.TimeUnitMilliseconds,
+	"us": types.TimeUnitMicroseconds,
+	"ns": types.TimeUnitNanoseconds,
+}
+
+func formatTime(t time.Time, unit string) (string, error) {
+	switch unit {
+	case "s":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	case "ms":
+		return strconv.FormatInt(t.UnixMilli(), 10), nil
+	case "us":
+		return strconv.FormatInt(t.UnixMicro(), 10), nil
+	case "ns":
+		return strconv.FormatInt(t.UnixNano(), 10), nil
+	default:
+		return "", fmt.Errorf("unsupported unit for time: %s", unit)
+	}
+}
+
+// formatFloat formats f with the shortest representation that parses back to the
+// same value when precision is -1, or with precision significant digits as given
+// by a "precision=N" tag option. NaN and infinities are rejected as Timestream
+// cannot store them.
+func formatFloat(f float64, bitSize int, precision int) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("cannot marshal non-finite float %v", f)
+	}
+	return strconv.FormatFloat(f, 'g', precision, bitSize), nil
+}
+
 func isZeroValue(v reflect.Value) bool {
 	// Check if the value is a string
 	if v.Kind() == reflect.String {
@@ -251,134 +436,303 @@ func isZeroValue(v reflect.Value) bool {
 	return false
 }
 
-func extractTagName(field reflect.StructField, tagParts []string) (string, bool) {
-	tagName := field.Name
-	omitEmpty := false
+// taggedField is a struct field carrying a timestream tag, found either at the
+// top level of the marshalled struct or inside an embedded or inlined struct.
+// index leads to the field as for reflect.Value.FieldByIndex, and path names it the
+// same way. name is the dimension or attribute name, prefixed by every inlined
+// struct on the way down, and column is the name shown in errors. readOnly is set
+// for unexported fields and fields of unexported inlined structs.
+type taggedField struct {
+	index    []int
+	path     string
+	field    reflect.StructField
+	tag      fieldTag
+	name     string
+	column   string
+	readOnly bool
+}
+
+// fieldError reports err for the field of a value of struct type root.
+func (f taggedField) fieldError(root reflect.Type, err error) error {
+	return &FieldError{
+		Type:   typeName(root),
+		Field:  f.path,
+		Tag:    f.field.Tag.Get("timestream"),
+		Column: f.column,
+		Err:    err,
+	}
+}
+
+// maxInlineDepth bounds the struct traversal so that cyclic embedded pointers
+// are reported instead of recursing forever.
+const maxInlineDepth = 32
+
+// collectFields walks struct type t and returns its tagged fields in declaration
+// order. Embedded structs are walked unless they carry a tag, and named struct
+// fields are walked when tagged with "inline", optionally with a "prefix=" option
+// that is prepended to the names of the fields underneath. Fields behind a nil
+// struct pointer are skipped when marshalling.
+func collectFields(t reflect.Type, w structWalk) ([]taggedField, error) {
+	var fields []taggedField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("timestream")
+		ok = ok && tag != ""
+		if tag == "-" {
+			continue
+		}
+		if strings.HasPrefix(tag, modeTagPrefix) {
+			if err := checkModeField(w, i, field, tag); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		index, path := w.at(i, field)
+		var parsed fieldTag
+		if ok {
+			var err error
+			if parsed, err = parseTag(tag); err != nil {
+				return nil, w.tagError(path, tag, err)
+			}
+		}
+
+		inlined := ok && parsed.kind == inlineTag
+		if inlined || (!ok && field.Anonymous) {
+			if !isInlineable(field.Type) {
+				if inlined {
+					return nil, w.tagError(path, tag, fmt.Errorf("inline can only be used with struct fields"))
+				}
+				continue
+			}
+
+			nestedType := field.Type
+			if nestedType.Kind() == reflect.Pointer {
+				nestedType = nestedType.Elem()
+			}
+			nw, err := w.nested(i, field, parsed.prefix)
+			if err != nil {
+				return nil, err
+			}
+			nested, err := collectFields(nestedType, nw)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+			continue
+		}
 
-	for _, part := range tagParts {
-		if part == "omitempty" {
-			omitEmpty = true
-		} else if strings.HasPrefix(part, "name=") {
-			tagName = strings.TrimPrefix(part, "name=")
+		if !ok {
+			continue
 		}
+
+		// Tags without a role only map query columns for Unmarshal.
+		if parsed.kind == "" {
+			continue
+		}
+
+		column, err := parsed.columnName(field, w.prefix)
+		if err != nil {
+			return nil, w.tagError(path, tag, err)
+		}
+		fields = append(fields, taggedField{
+			index:    index,
+			path:     path,
+			field:    field,
+			tag:      parsed,
+			name:     w.prefix + parsed.fieldName(field),
+			column:   column,
+			readOnly: w.readOnly || !field.IsExported(),
+		})
 	}
-	return tagName, omitEmpty
+	return fields, nil
 }
 
-func validateRequiredFields(v any) (reflect.Value, error) {
+func isInlineable(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if _, ok := nullableValueIndex(t); ok {
+		return false
+	}
+	return t.Kind() == reflect.Struct && t != timeType && !hasCustomCodec(t)
+}
+
+// validateRequiredFields checks v against the cached plan of its type, then checks
+// the values of its timestamp and measure. It returns the struct value along with
+// its fields and measure mode.
+func validateRequiredFields(v any, defaultMode MeasureMode) (reflect.Value, []taggedField, MeasureMode, error) {
 	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Pointer && !val.IsNil() {
+		val = val.Elem()
+	}
 	if val.Kind() != reflect.Struct {
-		return reflect.Value{}, fmt.Errorf("input is not a struct")
+		return reflect.Value{}, nil, "", fmt.Errorf("input is not a struct")
 	}
 
-	err := validateTypes(val)
+	plan, mode, err := validatePlan(val.Type(), defaultMode)
 	if err != nil {
-		return reflect.Value{}, err
+		return reflect.Value{}, nil, "", err
 	}
-	err = validateAppearances(val)
+	if err := validateValues(val, plan.fields); err != nil {
+		return reflect.Value{}, nil, "", err
+	}
+	return val, plan.fields, mode, nil
+}
+
+// validatePlan returns the cached plan of struct type t and its measure mode, or
+// the errors found in the tags and field types of t.
+func validatePlan(t reflect.Type, defaultMode MeasureMode) (*marshalPlan, MeasureMode, error) {
+	plan := marshalPlanOf(t)
+	if plan.err != nil {
+		return nil, "", plan.err
+	}
+
+	mode, err := measureModeOf(plan.mode, defaultMode)
 	if err != nil {
-		return reflect.Value{}, err
+		return nil, "", err
+	}
+	if err := plan.appearanceErrs[mode]; err != nil {
+		return nil, "", err
+	}
+	return plan, mode, nil
+}
+
+// validateValues checks the timestamp and measure of a struct value, the only
+// checks that depend on values rather than on the struct type.
+func validateValues(val reflect.Value, fields []taggedField) error {
+	for _, f := range fields {
+		if err := validateFieldTypeBasedOnTag(fieldValue(val, f.index), f.tag.kind); err != nil {
+			return f.fieldError(val.Type(), err)
+		}
+	}
+	return nil
+}
+
+// measureModeTag returns the measure mode selected by a blank mode field of t, or
+// an empty mode when t has none.
+func measureModeTag(t reflect.Type) MeasureMode {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("timestream")
+		if field.Name == "_" && strings.HasPrefix(tag, modeTagPrefix) {
+			return MeasureMode(strings.TrimPrefix(tag, modeTagPrefix))
+		}
+	}
+	return ""
+}
+
+// measureModeOf returns the measure mode selected by a struct, or defaultMode when
+// it selects none.
+func measureModeOf(mode, defaultMode MeasureMode) (MeasureMode, error) {
+	if mode == "" {
+		mode = defaultMode
+	}
+
+	switch mode {
+	case "", MultiMeasure:
+		return MultiMeasure, nil
+	case SingleMeasure:
+		return SingleMeasure, nil
+	default:
+		return "", fmt.Errorf("unsupported measure mode: %s", mode)
 	}
-	return val, nil
 }
 
-func validateAppearances(val reflect.Value) error {
+func validateAppearances(w structWalk, fields []taggedField, mode MeasureMode) error {
 	requiredTags := map[requiredField]int{
 		measure:   0,
 		timestamp: 0,
 		dimension: 0,
 		attribute: 0,
 	}
-	namesFrequency := make(map[string]int)
-	for i := 0; i < val.NumField(); i++ {
-		field := val.Type().Field(i)
-		tag, ok := field.Tag.Lookup("timestream")
-		if !ok {
-			continue
+	names := make(map[string]bool)
+	for _, f := range fields {
+		requiredTags[f.tag.kind]++
+		tag := f.field.Tag.Get("timestream")
+		// Assuming multiple dimensions and measureValues are allowed
+		if requiredTags[f.tag.kind] > 1 && (f.tag.kind == measure || f.tag.kind == timestamp) {
+			return w.tagError(f.path, tag, fmt.Errorf("tag type %s appears more than once", f.tag.kind))
 		}
-		tagParts := strings.Split(tag, ",")
-		requiredTags[requiredField(tagParts[0])]++
-		tagName, _ := extractTagName(field, tagParts)
-		_, ok = namesFrequency[tagName]
-		if !ok {
-			namesFrequency[tagName] = 1
-		} else {
-			namesFrequency[tagName]++
+		if names[f.name] {
+			return w.tagError(f.path, tag, fmt.Errorf("tag name %s appears multiple times", f.name))
 		}
+		names[f.name] = true
 	}
-	for tag, count := range requiredTags {
-		if count == 0 {
+	for _, tag := range []requiredField{timestamp, measure, dimension, attribute} {
+		// Single-measure records are named after their attribute.
+		if requiredTags[tag] == 0 && !(tag == measure && mode == SingleMeasure) {
 			return fmt.Errorf("missing required tag: %s", tag)
 		}
-		// Assuming multiple dimensions and measureValues are allowed
-		if count > 1 && (tag == measure || tag == timestamp) {
-			return fmt.Errorf("tag type %s appears more than once", tag)
-		}
-	}
-	for tn, count := range namesFrequency {
-		if count > 1 {
-			return fmt.Errorf("tag name %s appears multiple times", tn)
-		}
 	}
 	return nil
 }
 
-func validateTypes(val reflect.Value) error {
-	for i := 0; i < val.NumField(); i++ {
-		field := val.Field(i)
-		fieldType := val.Type().Field(i)
-
-		if err := validateField(field, fieldType); err != nil {
-			return err
+// validateTypes checks the tags and accessibility of fields, which only depend on
+// their type.
+func validateTypes(w structWalk, fields []taggedField) error {
+	for _, f := range fields {
+		if err := validateField(f); err != nil {
+			return w.tagError(f.path, f.field.Tag.Get("timestream"), err)
 		}
 	}
 	return nil
 }
 
-func validateField(field reflect.Value, fieldType reflect.StructField) error {
-	tag, ok := fieldType.Tag.Lookup("timestream")
-	if !ok {
-		return nil
-	}
-
-	tagParts := strings.Split(tag, ",")
-	if err := checkOmitEmpty(fieldType, tagParts); err != nil {
+func validateField(f taggedField) error {
+	if err := checkOmitEmpty(f.field, f.tag); err != nil {
 		return err
 	}
-
-	if err := checkFieldAccessibility(field, fieldType); err != nil {
+	if err := checkDimensionType(f); err != nil {
 		return err
 	}
 
-	return validateFieldTypeBasedOnTag(field, tag)
+	return checkFieldAccessibility(f)
 }
 
-func checkOmitEmpty(fieldType reflect.StructField, tagParts []string) error {
-	_, omitEmpty := extractTagName(fieldType, tagParts)
-	if omitEmpty && fieldType.Type.Kind() != reflect.String {
-		return fmt.Errorf("omitempty can only be used with string fields, found in field '%s'", fieldType.Name)
+func checkOmitEmpty(fieldType reflect.StructField, tag fieldTag) error {
+	if tag.omitEmpty && indirectType(fieldType.Type).Kind() != reflect.String {
+		return fmt.Errorf("omitempty can only be used with string fields")
 	}
 	return nil
 }
 
-func checkFieldAccessibility(field reflect.Value, fieldType reflect.StructField) error {
-	if !field.CanInterface() {
-		return fmt.Errorf("field %s is not accessible, needs to be public", fieldType.Name)
+// checkDimensionType checks that a dimension field holds a string, or a type
+// marshalling itself, as dimension values are always VARCHAR.
+func checkDimensionType(f taggedField) error {
+	if f.tag.kind != dimension {
+		return nil
+	}
+	t := indirectType(f.field.Type)
+	if t.Kind() != reflect.String && !hasMarshaler(t) {
+		return fmt.Errorf("dimension field %s is not a string", f.field.Name)
+	}
+	return nil
+}
+
+func checkFieldAccessibility(f taggedField) error {
+	if f.readOnly {
+		return fmt.Errorf("field is not accessible, needs to be public")
 	}
 	return nil
 }
 
-func validateFieldTypeBasedOnTag(field reflect.Value, tag string) error {
-	switch tag {
-	case string(timestamp):
+func validateFieldTypeBasedOnTag(field reflect.Value, kind requiredField) error {
+	switch kind {
+	case timestamp:
 		return validateTimestampField(field)
-	case string(measure):
+	case measure:
 		return validateMeasureField(field)
 	}
 	return nil
 }
 
 func validateTimestampField(field reflect.Value) error {
+	field, present := indirect(field)
+	if !present {
+		return fmt.Errorf("timestamp field is missing")
+	}
 	timestamp, ok := field.Interface().(time.Time)
 	if !ok || timestamp.IsZero() {
 		return fmt.Errorf("timestamp field is either not a time.Time or has a zero value")
@@ -387,8 +741,11 @@ func validateTimestampField(field reflect.Value) error {
 }
 
 func validateMeasureField(field reflect.Value) error {
-	measureName, ok := field.Interface().(string)
-	if !ok || measureName == "" {
+	field, present := indirect(field)
+	if !present {
+		return fmt.Errorf("measureName field is missing")
+	}
+	if field.Kind() != reflect.String || field.String() == "" {
 		return fmt.Errorf("measureName field is either not a string or has a zero value")
 	}
 	return nil
@@ -1,12 +1,17 @@
 package timestream_test
 
 import (
+	"database/sql"
 	"fmt"
+	"math"
+	"sync"
 	"testing"
 	"time"
 
 	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	querytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -19,6 +24,58 @@ var (
 	formattedNow = fmt.Sprintf("%d", now.UnixMilli())
 )
 
+// testAmount is a fixed point amount marshalled as a DOUBLE through TimestreamMarshaler.
+type testAmount struct {
+	cents int64
+}
+
+func (a testAmount) MarshalTimestream() (types.MeasureValueType, string, error) {
+	return types.MeasureValueTypeDouble, fmt.Sprintf("%d.%02d", a.cents/100, a.cents%100), nil
+}
+
+func (a *testAmount) UnmarshalTimestream(_ types.MeasureValueType, value string) error {
+	var units, cents int64
+	if _, err := fmt.Sscanf(value, "%d.%d", &units, &cents); err != nil {
+		return err
+	}
+	a.cents = units*100 + cents
+	return nil
+}
+
+// testStatus is an enum marshalled as a VARCHAR through encoding.TextMarshaler.
+type testStatus int
+
+const (
+	testStatusIdle testStatus = iota
+	testStatusCharging
+)
+
+var testStatusNames = []string{"idle", "charging"}
+
+func (s testStatus) MarshalText() ([]byte, error) {
+	if int(s) >= len(testStatusNames) {
+		return nil, fmt.Errorf("unknown status %d", int(s))
+	}
+	return []byte(testStatusNames[s]), nil
+}
+
+func (s *testStatus) UnmarshalText(text []byte) error {
+	for i, name := range testStatusNames {
+		if name == string(text) {
+			*s = testStatus(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %q", text)
+}
+
+// testMultiValue returns a measure value type that cannot be used for a single value.
+type testMultiValue struct{}
+
+func (testMultiValue) MarshalTimestream() (types.MeasureValueType, string, error) {
+	return types.MeasureValueTypeMulti, "", nil
+}
+
 func TestMarshal(t *testing.T) {
 	tests := []struct {
 		name string
@@ -63,7 +120,7 @@ func TestMarshal(t *testing.T) {
 				},
 				MeasureValues: []types.MeasureValue{
 					{Name: aws.String("someMeasureValue"), Value: aws.String("66"), Type: types.MeasureValueTypeVarchar},
-					{Name: aws.String("measureValueFloat"), Value: aws.String("123.000000"), Type: types.MeasureValueTypeDouble},
+					{Name: aws.String("measureValueFloat"), Value: aws.String("123"), Type: types.MeasureValueTypeDouble},
 					{Name: aws.String("measureValueInt"), Value: aws.String("123"), Type: types.MeasureValueTypeBigint},
 					{Name: aws.String("emptyString"), Value: aws.String("-"), Type: types.MeasureValueTypeVarchar},
 					{Name: aws.String("arrivalTime"), Value: aws.String(fmt.Sprintf("%d", arrivalTime.Unix())), Type: types.MeasureValueTypeTimestamp},
@@ -71,7 +128,8 @@ func TestMarshal(t *testing.T) {
 					{Name: aws.String("arrivalTimeNs"), Value: aws.String(fmt.Sprintf("%d", arrivalTime.UnixNano())), Type: types.MeasureValueTypeTimestamp},
 					{Name: aws.String("arrivalTimeS"), Value: aws.String(fmt.Sprintf("%d", arrivalTime.Unix())), Type: types.MeasureValueTypeTimestamp},
 				},
-				MeasureName: aws.String("measure_name"),
+				MeasureName:      aws.String("measure_name"),
+				MeasureValueType: types.MeasureValueTypeMulti,
 			}},
 		},
 		{
@@ -102,7 +160,8 @@ func TestMarshal(t *testing.T) {
 					MeasureValues: []types.MeasureValue{
 						{Name: aws.String("someMeasureValue"), Value: aws.String("some_string"), Type: types.MeasureValueTypeVarchar},
 					},
-					MeasureName: aws.String("measure_name"),
+					MeasureName:      aws.String("measure_name"),
+					MeasureValueType: types.MeasureValueTypeMulti,
 				},
 				{
 					Time:       aws.String(fmt.Sprintf("%d", now.Add(1*time.Second).UnixMilli())),
@@ -110,7 +169,8 @@ func TestMarshal(t *testing.T) {
 					MeasureValues: []types.MeasureValue{
 						{Name: aws.String("someMeasureValue"), Value: aws.String("some_another_value"), Type: types.MeasureValueTypeVarchar},
 					},
-					MeasureName: aws.String("measure_name"),
+					MeasureName:      aws.String("measure_name"),
+					MeasureValueType: types.MeasureValueTypeMulti,
 				},
 			},
 		},
@@ -126,6 +186,540 @@ func TestMarshal(t *testing.T) {
 	}
 }
 
+func TestMarshalNested(t *testing.T) {
+	type Header struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+	}
+	type Battery struct {
+		Site  string  `timestream:"dimension,name=site"`
+		Power float64 `timestream:"attribute,name=power"`
+	}
+	type Inverter struct {
+		Model   string  `timestream:"dimension,name=model"`
+		Battery Battery `timestream:"inline,prefix=battery_"`
+	}
+	type Reading struct {
+		Header
+		Site     string   `timestream:"dimension,name=site"`
+		Inverter Inverter `timestream:"inline,prefix=inverter_"`
+		Ignored  Battery
+	}
+
+	got, err := timestream.Marshal(Reading{
+		Header:   Header{Timestamp: now, MeasureName: "measure_name"},
+		Site:     "site-1",
+		Inverter: Inverter{Model: "X1", Battery: Battery{Site: "site-2", Power: 1.5}},
+		Ignored:  Battery{Site: "ignored", Power: 2},
+	})
+	assert.NoError(t, err)
+
+	want := []types.Record{{
+		Time:             &formattedNow,
+		MeasureName:      aws.String("measure_name"),
+		MeasureValueType: types.MeasureValueTypeMulti,
+		Dimensions: []types.Dimension{
+			{Name: aws.String("site"), Value: aws.String("site-1")},
+			{Name: aws.String("inverter_model"), Value: aws.String("X1")},
+			{Name: aws.String("inverter_battery_site"), Value: aws.String("site-2")},
+		},
+		MeasureValues: []types.MeasureValue{
+			{Name: aws.String("inverter_battery_power"), Value: aws.String("1.5"), Type: types.MeasureValueTypeDouble},
+		},
+	}}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(types.Record{}, types.Dimension{}, types.MeasureValue{})); diff != "" {
+		t.Errorf("Marshal() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMarshalPointers(t *testing.T) {
+	type Reading struct {
+		Timestamp   *time.Time      `timestream:"timestamp"`
+		MeasureName *string         `timestream:"measure"`
+		Site        *string         `timestream:"dimension,name=site"`
+		Region      *string         `timestream:"dimension,name=region"`
+		Power       *float64        `timestream:"attribute,name=power"`
+		Energy      *float64        `timestream:"attribute,name=energy"`
+		Note        *string         `timestream:"attribute,name=note,omitempty"`
+		Price       sql.NullFloat64 `timestream:"attribute,name=price"`
+		Tariff      sql.NullString  `timestream:"attribute,name=tariff"`
+		ReceivedAt  sql.NullTime    `timestream:"attribute,name=receivedAt,unit=ms"`
+	}
+
+	got, err := timestream.Marshal([]*Reading{{
+		Timestamp:   &now,
+		MeasureName: aws.String("measure_name"),
+		Site:        aws.String("site-1"),
+		Power:       aws.Float64(1.5),
+		Note:        aws.String(""),
+		Price:       sql.NullFloat64{Float64: 0.25, Valid: true},
+		Tariff:      sql.NullString{String: "peak"},
+		ReceivedAt:  sql.NullTime{Time: arrivalTime, Valid: true},
+	}})
+	assert.NoError(t, err)
+
+	want := []types.Record{{
+		Time:             &formattedNow,
+		MeasureName:      aws.String("measure_name"),
+		MeasureValueType: types.MeasureValueTypeMulti,
+		Dimensions:       []types.Dimension{{Name: aws.String("site"), Value: aws.String("site-1")}},
+		MeasureValues: []types.MeasureValue{
+			{Name: aws.String("power"), Value: aws.String("1.5"), Type: types.MeasureValueTypeDouble},
+			{Name: aws.String("price"), Value: aws.String("0.25"), Type: types.MeasureValueTypeDouble},
+			{Name: aws.String("receivedAt"), Value: aws.String(fmt.Sprintf("%d", arrivalTime.UnixMilli())), Type: types.MeasureValueTypeTimestamp},
+		},
+	}}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(types.Record{}, types.Dimension{}, types.MeasureValue{})); diff != "" {
+		t.Errorf("Marshal() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMarshalPointersUnhappyPath(t *testing.T) {
+	type Reading struct {
+		Timestamp   *time.Time `timestream:"timestamp"`
+		MeasureName *string    `timestream:"measure"`
+		Site        string     `timestream:"dimension,name=site"`
+		Power       *float64   `timestream:"attribute,name=power"`
+	}
+
+	tests := []struct {
+		name string
+		args any
+	}{
+		{
+			name: "Returns err if timestamp is nil",
+			args: Reading{MeasureName: aws.String("measure_name"), Site: "site-1"},
+		},
+		{
+			name: "Returns err if measure is nil",
+			args: Reading{Timestamp: &now, Site: "site-1"},
+		},
+		{
+			name: "Returns err on nil struct pointer",
+			args: (*Reading)(nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := timestream.Marshal(tt.args)
+			assert.Error(t, err)
+			assert.Nil(t, res)
+		})
+	}
+}
+
+func TestMarshalCustomTypes(t *testing.T) {
+	type Reading struct {
+		Timestamp   time.Time   `timestream:"timestamp"`
+		MeasureName string      `timestream:"measure"`
+		Status      testStatus  `timestream:"dimension,name=status"`
+		Price       testAmount  `timestream:"attribute,name=price"`
+		Target      *testAmount `timestream:"attribute,name=target"`
+		Mode        testStatus  `timestream:"attribute,name=mode"`
+	}
+
+	got, err := timestream.Marshal(Reading{
+		Timestamp:   now,
+		MeasureName: "measure_name",
+		Status:      testStatusCharging,
+		Price:       testAmount{cents: 1234},
+		Mode:        testStatusIdle,
+	})
+	assert.NoError(t, err)
+
+	want := []types.Record{{
+		Time:             &formattedNow,
+		MeasureName:      aws.String("measure_name"),
+		MeasureValueType: types.MeasureValueTypeMulti,
+		Dimensions:       []types.Dimension{{Name: aws.String("status"), Value: aws.String("charging")}},
+		MeasureValues: []types.MeasureValue{
+			{Name: aws.String("price"), Value: aws.String("12.34"), Type: types.MeasureValueTypeDouble},
+			{Name: aws.String("mode"), Value: aws.String("idle"), Type: types.MeasureValueTypeVarchar},
+		},
+	}}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(types.Record{}, types.Dimension{}, types.MeasureValue{})); diff != "" {
+		t.Errorf("Marshal() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMarshalCustomTypesUnhappyPath(t *testing.T) {
+	tests := []struct {
+		name string
+		args any
+	}{
+		{
+			name: "Returns err if the marshaler fails",
+			args: struct {
+				Timestamp   time.Time  `timestream:"timestamp"`
+				MeasureName string     `timestream:"measure"`
+				Dimension   string     `timestream:"dimension"`
+				Status      testStatus `timestream:"attribute,name=status"`
+			}{Timestamp: now, MeasureName: "measure_name", Status: testStatus(42)},
+		},
+		{
+			name: "Returns err if the marshaler returns MULTI",
+			args: struct {
+				Timestamp   time.Time      `timestream:"timestamp"`
+				MeasureName string         `timestream:"measure"`
+				Dimension   string         `timestream:"dimension"`
+				Value       testMultiValue `timestream:"attribute,name=value"`
+			}{Timestamp: now, MeasureName: "measure_name"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := timestream.Marshal(tt.args)
+			assert.Error(t, err)
+			assert.Nil(t, res)
+		})
+	}
+}
+
+func TestMarshalBooleanAndUnsigned(t *testing.T) {
+	got, err := timestream.Marshal(struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Dimension   string    `timestream:"dimension,name=site"`
+		Charging    bool      `timestream:"attribute,name=charging"`
+		Cycles      uint32    `timestream:"attribute,name=cycles"`
+		Flags       uint8     `timestream:"attribute,name=flags"`
+		Offset      int16     `timestream:"attribute,name=offset"`
+		Ratio       float32   `timestream:"attribute,name=ratio"`
+	}{
+		Timestamp:   now,
+		MeasureName: "measure_name",
+		Dimension:   "site-1",
+		Charging:    true,
+		Cycles:      math.MaxUint32,
+		Flags:       7,
+		Offset:      -3,
+		Ratio:       0.5,
+	})
+	assert.NoError(t, err)
+
+	want := []types.Record{{
+		Time:             &formattedNow,
+		MeasureName:      aws.String("measure_name"),
+		MeasureValueType: types.MeasureValueTypeMulti,
+		Dimensions:       []types.Dimension{{Name: aws.String("site"), Value: aws.String("site-1")}},
+		MeasureValues: []types.MeasureValue{
+			{Name: aws.String("charging"), Value: aws.String("true"), Type: types.MeasureValueTypeBoolean},
+			{Name: aws.String("cycles"), Value: aws.String("4294967295"), Type: types.MeasureValueTypeBigint},
+			{Name: aws.String("flags"), Value: aws.String("7"), Type: types.MeasureValueTypeBigint},
+			{Name: aws.String("offset"), Value: aws.String("-3"), Type: types.MeasureValueTypeBigint},
+			{Name: aws.String("ratio"), Value: aws.String("0.5"), Type: types.MeasureValueTypeDouble},
+		},
+	}}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(types.Record{}, types.Dimension{}, types.MeasureValue{})); diff != "" {
+		t.Errorf("Marshal() mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = timestream.Marshal(struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Dimension   string    `timestream:"dimension,name=site"`
+		Counter     uint64    `timestream:"attribute,name=counter"`
+	}{Timestamp: now, MeasureName: "measure_name", Dimension: "site-1", Counter: math.MaxUint64})
+	assert.Error(t, err, "uint64 values above MaxInt64 overflow BIGINT")
+}
+
+func TestMarshalTimestampUnit(t *testing.T) {
+	type Reading struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Dimension   string    `timestream:"dimension,name=site"`
+		Power       float64   `timestream:"attribute,name=power"`
+	}
+	type MicroReading struct {
+		Timestamp   time.Time `timestream:"timestamp,unit=us"`
+		MeasureName string    `timestream:"measure"`
+		Dimension   string    `timestream:"dimension,name=site"`
+		Power       float64   `timestream:"attribute,name=power"`
+	}
+
+	tests := []struct {
+		name     string
+		args     any
+		opts     []timestream.MarshalOption
+		wantTime string
+		wantUnit types.TimeUnit
+	}{
+		{
+			name:     "Defaults to milliseconds without a time unit",
+			args:     Reading{Timestamp: now, MeasureName: "measure_name", Dimension: "site-1"},
+			wantTime: formattedNow,
+		},
+		{
+			name:     "Uses the unit from the tag",
+			args:     MicroReading{Timestamp: now, MeasureName: "measure_name", Dimension: "site-1"},
+			wantTime: fmt.Sprintf("%d", now.UnixMicro()),
+			wantUnit: types.TimeUnitMicroseconds,
+		},
+		{
+			name:     "Uses the unit from the options",
+			args:     Reading{Timestamp: now, MeasureName: "measure_name", Dimension: "site-1"},
+			opts:     []timestream.MarshalOption{timestream.WithTimeUnit("ns")},
+			wantTime: fmt.Sprintf("%d", now.UnixNano()),
+			wantUnit: types.TimeUnitNanoseconds,
+		},
+		{
+			name:     "Prefers the unit from the tag over the options",
+			args:     MicroReading{Timestamp: now, MeasureName: "measure_name", Dimension: "site-1"},
+			opts:     []timestream.MarshalOption{timestream.WithTimeUnit("s")},
+			wantTime: fmt.Sprintf("%d", now.UnixMicro()),
+			wantUnit: types.TimeUnitMicroseconds,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timestream.Marshal(tt.args, tt.opts...)
+			assert.NoError(t, err)
+			assert.Len(t, got, 1)
+			assert.Equal(t, tt.wantTime, *got[0].Time)
+			assert.Equal(t, tt.wantUnit, got[0].TimeUnit)
+		})
+	}
+
+	_, err := timestream.Marshal(Reading{Timestamp: now, MeasureName: "measure_name", Dimension: "site-1"}, timestream.WithTimeUnit("h"))
+	assert.Error(t, err)
+
+	_, err = timestream.Marshal(MicroReading{MeasureName: "measure_name", Dimension: "site-1"})
+	assert.Error(t, err, "zero timestamps are rejected regardless of the tag options")
+}
+
+func TestMarshalFloatFormatting(t *testing.T) {
+	type Reading struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Dimension   string    `timestream:"dimension,name=site"`
+		Tiny        float64   `timestream:"attribute,name=tiny"`
+		Huge        float64   `timestream:"attribute,name=huge"`
+		Single      float32   `timestream:"attribute,name=single"`
+		Rounded     float64   `timestream:"attribute,name=rounded,precision=3"`
+	}
+
+	got, err := timestream.Marshal(Reading{
+		Timestamp:   now,
+		MeasureName: "measure_name",
+		Dimension:   "site-1",
+		Tiny:        0.000000123,
+		Huge:        1e300,
+		Single:      0.1,
+		Rounded:     3.14159,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, got, 1)
+
+	values := make(map[string]string)
+	for _, mv := range got[0].MeasureValues {
+		values[*mv.Name] = *mv.Value
+	}
+	assert.Equal(t, map[string]string{"tiny": "1.23e-07", "huge": "1e+300", "single": "0.1", "rounded": "3.14"}, values)
+
+	for name, value := range map[string]float64{"NaN": math.NaN(), "+Inf": math.Inf(1), "-Inf": math.Inf(-1)} {
+		t.Run("Returns err on "+name, func(t *testing.T) {
+			_, err := timestream.Marshal(Reading{Timestamp: now, MeasureName: "measure_name", Dimension: "site-1", Tiny: value})
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = timestream.Marshal(struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Dimension   string    `timestream:"dimension,name=site"`
+		Value       float64   `timestream:"attribute,name=value,precision=x"`
+	}{Timestamp: now, MeasureName: "measure_name", Dimension: "site-1"})
+	assert.Error(t, err)
+}
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	type Reading struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Dimension   string    `timestream:"dimension,name=site"`
+		Price       float64   `timestream:"attribute,name=price"`
+		Huge        float64   `timestream:"attribute,name=huge"`
+		Negative    float64   `timestream:"attribute,name=negative"`
+		Single      float32   `timestream:"attribute,name=single"`
+	}
+	type Row struct {
+		Price    float64 `timestream:"name=price"`
+		Huge     float64 `timestream:"name=huge"`
+		Negative float64 `timestream:"name=negative"`
+		Single   float32 `timestream:"name=single"`
+	}
+
+	in := Reading{
+		Timestamp:   now,
+		MeasureName: "measure_name",
+		Dimension:   "site-1",
+		Price:       0.000031415926535,
+		Huge:        math.MaxFloat64,
+		Negative:    -123456.789012345678,
+		Single:      math.SmallestNonzeroFloat32,
+	}
+	records, err := timestream.Marshal(in)
+	assert.NoError(t, err)
+
+	// Shape the measure values the way a query selecting them would return them.
+	var output timestreamquery.QueryOutput
+	var row querytypes.Row
+	for _, mv := range records[0].MeasureValues {
+		output.ColumnInfo = append(output.ColumnInfo, querytypes.ColumnInfo{
+			Name: mv.Name,
+			Type: &querytypes.Type{ScalarType: querytypes.ScalarTypeDouble},
+		})
+		row.Data = append(row.Data, querytypes.Datum{ScalarValue: mv.Value})
+	}
+	output.Rows = []querytypes.Row{row}
+
+	var out Row
+	err = timestream.Unmarshal(&output, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, Row{Price: in.Price, Huge: in.Huge, Negative: in.Negative, Single: in.Single}, out)
+}
+
+func TestMarshalSingleMeasure(t *testing.T) {
+	type Reading struct {
+		Timestamp time.Time `timestream:"timestamp,unit=s"`
+		Site      string    `timestream:"dimension,name=site"`
+		Power     float64   `timestream:"attribute,name=power"`
+		Charging  bool      `timestream:"attribute,name=charging"`
+	}
+	type TaggedReading struct {
+		_         struct{}  `timestream:"mode=single"`
+		Timestamp time.Time `timestream:"timestamp,unit=s"`
+		Site      string    `timestream:"dimension,name=site"`
+		Power     float64   `timestream:"attribute,name=power"`
+		Charging  bool      `timestream:"attribute,name=charging"`
+	}
+
+	formattedTime := fmt.Sprintf("%d", now.Unix())
+	want := []types.Record{
+		{
+			Time:             &formattedTime,
+			TimeUnit:         types.TimeUnitSeconds,
+			Dimensions:       []types.Dimension{{Name: aws.String("site"), Value: aws.String("site-1")}},
+			MeasureName:      aws.String("power"),
+			MeasureValue:     aws.String("1.5"),
+			MeasureValueType: types.MeasureValueTypeDouble,
+		},
+		{
+			Time:             &formattedTime,
+			TimeUnit:         types.TimeUnitSeconds,
+			Dimensions:       []types.Dimension{{Name: aws.String("site"), Value: aws.String("site-1")}},
+			MeasureName:      aws.String("charging"),
+			MeasureValue:     aws.String("true"),
+			MeasureValueType: types.MeasureValueTypeBoolean,
+		},
+	}
+
+	tests := []struct {
+		name string
+		args any
+		opts []timestream.MarshalOption
+	}{
+		{
+			name: "Uses the mode from the options",
+			args: Reading{Timestamp: now, Site: "site-1", Power: 1.5, Charging: true},
+			opts: []timestream.MarshalOption{timestream.WithMeasureMode(timestream.SingleMeasure)},
+		},
+		{
+			name: "Uses the mode from the struct",
+			args: TaggedReading{Timestamp: now, Site: "site-1", Power: 1.5, Charging: true},
+		},
+		{
+			name: "Prefers the mode from the struct over the options",
+			args: TaggedReading{Timestamp: now, Site: "site-1", Power: 1.5, Charging: true},
+			opts: []timestream.MarshalOption{timestream.WithMeasureMode(timestream.MultiMeasure)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timestream.Marshal(tt.args, tt.opts...)
+			assert.NoError(t, err)
+			if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(types.Record{}, types.Dimension{}, types.MeasureValue{})); diff != "" {
+				t.Errorf("Marshal() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	got, err := timestream.Marshal([]TaggedReading{
+		{Timestamp: now, Site: "site-1", Power: 1.5},
+		{Timestamp: now, Site: "site-2", Power: 2.5},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, got, 4)
+
+	_, err = timestream.Marshal(Reading{Timestamp: now, Site: "site-1"})
+	assert.Error(t, err, "the measure is required in MULTI mode")
+
+	_, err = timestream.Marshal(Reading{Timestamp: now, Site: "site-1"}, timestream.WithMeasureMode("dual"))
+	assert.Error(t, err)
+
+	type ModeOnField struct {
+		Timestamp time.Time `timestream:"timestamp,unit=s"`
+		Site      string    `timestream:"dimension,name=site"`
+		Power     float64   `timestream:"mode=single"`
+	}
+	_, err = timestream.Marshal(ModeOnField{Timestamp: now, Site: "site-1", Power: 1.5})
+	var tagErr *timestream.TagError
+	if assert.ErrorAs(t, err, &tagErr, "mode is only read from a blank field") {
+		assert.Equal(t, "Power", tagErr.Field)
+	}
+	var row ModeOnField
+	err = timestream.Unmarshal(&timestreamquery.QueryOutput{}, &row)
+	assert.ErrorAs(t, err, &tagErr)
+}
+
+func TestMarshalNestedUnhappyPath(t *testing.T) {
+	type Header struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+	}
+	type Battery struct {
+		Site  string  `timestream:"dimension,name=site"`
+		Power float64 `timestream:"attribute,name=power"`
+	}
+
+	tests := []struct {
+		name string
+		args any
+	}{
+		{
+			name: "Returns err if names collide across the flattened struct",
+			args: struct {
+				Header
+				Site    string  `timestream:"dimension,name=site"`
+				Battery Battery `timestream:"inline"`
+			}{Header: Header{Timestamp: now, MeasureName: "measure_name"}, Site: "a", Battery: Battery{Site: "b"}},
+		},
+		{
+			name: "Returns err if timestamp appears at two depths",
+			args: struct {
+				Header
+				Other   Header  `timestream:"inline,prefix=other_"`
+				Battery Battery `timestream:"inline"`
+			}{Header: Header{Timestamp: now, MeasureName: "measure_name"}, Other: Header{Timestamp: now, MeasureName: "x"}},
+		},
+		{
+			name: "Returns err if inline is used on a non-struct",
+			args: struct {
+				Header
+				Battery Battery `timestream:"inline"`
+				Site    string  `timestream:"inline"`
+			}{Header: Header{Timestamp: now, MeasureName: "measure_name"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := timestream.Marshal(tt.args)
+			assert.Error(t, err)
+			assert.Nil(t, res)
+		})
+	}
+}
+
 func TestMarshalUnhappyPath(t *testing.T) {
 	tests := []struct {
 		name string
@@ -305,3 +899,50 @@ func TestMarshalUnhappyPath(t *testing.T) {
 		})
 	}
 }
+
+func TestMarshalCachedPlans(t *testing.T) {
+	type Invalid struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Power       int       `timestream:"attribute,omitempty"`
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := timestream.Marshal(Invalid{Timestamp: now, MeasureName: "metrics"})
+		assert.EqualError(t, err, `invalid struct, invalid tag "attribute,omitempty" on field Power of timestream_test.Invalid: omitempty can only be used with string fields`, "call %d", i)
+	}
+
+	// Concurrent calls share the plan of the type, run with -race.
+	readings := newWriterReadings(10)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			records, err := timestream.Marshal(readings)
+			assert.NoError(t, err)
+			assert.Len(t, records, len(readings))
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	for _, n := range []int{1, 10000} {
+		readings := newWriterReadings(n)
+		for _, cached := range []bool{true, false} {
+			b.Run(fmt.Sprintf("records=%d/cached=%t", n, cached), func(b *testing.B) {
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if !cached {
+						timestream.ResetTypeCaches()
+					}
+					if _, err := timestream.Marshal(readings); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package timestream
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+)
+
+// TimestreamMarshaler is implemented by types that can marshal themselves into a
+// Timestream measure value. MarshalTimestream returns the measure value type along
+// with the string representation of the value, e.g. types.MeasureValueTypeDouble and "12.5".
+// When used as a dimension only the string representation is kept.
+type TimestreamMarshaler interface {
+	MarshalTimestream() (types.MeasureValueType, string, error)
+}
+
+// TimestreamUnmarshaler is implemented by types that can unmarshal a Timestream value
+// into themselves. UnmarshalTimestream receives the measure value type matching the
+// column type of the query output, along with the raw string value of the column.
+// The method must have a pointer receiver.
+type TimestreamUnmarshaler interface {
+	UnmarshalTimestream(valueType types.MeasureValueType, value string) error
+}
+
+var (
+	marshalerType       = reflect.TypeOf((*TimestreamMarshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*TimestreamUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// hasCustomCodec reports whether values of type t marshal or unmarshal themselves
+// through TimestreamMarshaler, TimestreamUnmarshaler or their encoding.Text* fallbacks.
+// time.Time is excluded as it is handled natively.
+func hasCustomCodec(t reflect.Type) bool {
+	if t == timeType {
+		return false
+	}
+
+	pt := reflect.PointerTo(t)
+	return pt.Implements(marshalerType) || pt.Implements(unmarshalerType) ||
+		pt.Implements(textMarshalerType) || pt.Implements(textUnmarshalerType)
+}
+
+// hasMarshaler reports whether values of type t marshal themselves through
+// TimestreamMarshaler or encoding.TextMarshaler, as marshalCustom does.
+func hasMarshaler(t reflect.Type) bool {
+	if t == timeType {
+		return false
+	}
+
+	pt := reflect.PointerTo(t)
+	return pt.Implements(marshalerType) || pt.Implements(textMarshalerType)
+}
+
+// marshalCustom marshals v through TimestreamMarshaler, falling back to
+// encoding.TextMarshaler which yields a VARCHAR. It reports false when v
+// implements neither.
+func marshalCustom(v reflect.Value) (types.MeasureValueType, string, bool, error) {
+	if v.Type() == timeType {
+		return "", "", false, nil
+	}
+
+	// Copy the value so that methods with a pointer receiver are found too.
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+
+	switch m := ptr.Interface().(type) {
+	case TimestreamMarshaler:
+		valueType, value, err := m.MarshalTimestream()
+		if err != nil {
+			return "", "", true, fmt.Errorf("failed to marshal %s: %w", v.Type(), err)
+		}
+		if !isScalarMeasureValueType(valueType) {
+			return "", "", true, fmt.Errorf("invalid measure value type %q returned by %s", valueType, v.Type())
+		}
+		return valueType, value, true, nil
+	case encoding.TextMarshaler:
+		text, err := m.MarshalText()
+		if err != nil {
+			return "", "", true, fmt.Errorf("failed to marshal %s: %w", v.Type(), err)
+		}
+		return types.MeasureValueTypeVarchar, string(text), true, nil
+	}
+	return "", "", false, nil
+}
+
+// unmarshalCustom unmarshals data into v through TimestreamUnmarshaler, falling
+// back to encoding.TextUnmarshaler. It reports false when v implements neither.
+func unmarshalCustom(v reflect.Value, valueType types.MeasureValueType, data string) (bool, error) {
+	if v.Type() == timeType || !v.CanAddr() {
+		return false, nil
+	}
+
+	switch u := v.Addr().Interface().(type) {
+	case TimestreamUnmarshaler:
+		if err := u.UnmarshalTimestream(valueType, data); err != nil {
+			return true, fmt.Errorf("failed to unmarshal %s: %w", v.Type(), err)
+		}
+		return true, nil
+	case encoding.TextUnmarshaler:
+		if err := u.UnmarshalText([]byte(data)); err != nil {
+			return true, fmt.Errorf("failed to unmarshal %s: %w", v.Type(), err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func isScalarMeasureValueType(valueType types.MeasureValueType) bool {
+	switch valueType {
+	case types.MeasureValueTypeDouble, types.MeasureValueTypeBigint, types.MeasureValueTypeVarchar,
+		types.MeasureValueTypeBoolean, types.MeasureValueTypeTimestamp:
+		return true
+	}
+	return false
+}
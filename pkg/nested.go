@@ -0,0 +1,209 @@
+package timestream
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+)
+
+// TimeSeriesPoint is a point of a TIMESERIES value, as returned by CREATE_TIME_SERIES
+// or INTERPOLATE_* functions. A []TimeSeriesPoint[T] field decodes such a column,
+// with T being the type of the measure values. A slice of any struct with a field
+// tagged `timestream:"time"` works too: the measure value goes into the field tagged
+// `timestream:"name=value"`, or, for multi-measure ROW values, into the fields
+// named after the row fields.
+type TimeSeriesPoint[T any] struct {
+	Time  time.Time `timestream:"time"`
+	Value T         `timestream:"name=value"`
+}
+
+var timestampColumn = types.ColumnInfo{
+	Name: aws.String(timeColumn),
+	Type: &types.Type{ScalarType: types.ScalarTypeTimestamp},
+}
+
+// isNullDatum reports whether datum is NULL, either explicitly or by holding no
+// value at all.
+func isNullDatum(datum types.Datum) bool {
+	if aws.ToBool(datum.NullValue) {
+		return true
+	}
+	return datum.ScalarValue == nil && datum.ArrayValue == nil && datum.RowValue == nil && datum.TimeSeriesValue == nil
+}
+
+// decodeDatum decodes a scalar, ARRAY, ROW or TIMESERIES value into field. NULL
+// leaves pointers nil, nullable wrappers invalid and anything else at its zero value.
+func decodeDatum(field reflect.Value, column types.ColumnInfo, datum types.Datum) error {
+	switch {
+	case isNullDatum(datum):
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	case datum.ScalarValue != nil:
+		return setFieldValue(field, column, *datum.ScalarValue)
+	}
+
+	if field.Kind() == reflect.Pointer {
+		elem := reflect.New(field.Type().Elem())
+		if err := decodeDatum(elem.Elem(), column, datum); err != nil {
+			return err
+		}
+
+		field.Set(elem)
+		return nil
+	}
+
+	if i, ok := nullableValueIndex(field.Type()); ok {
+		if err := decodeDatum(field.Field(i), column, datum); err != nil {
+			return err
+		}
+
+		field.FieldByName("Valid").SetBool(true)
+		return nil
+	}
+
+	switch {
+	case datum.ArrayValue != nil:
+		return decodeArray(field, column, datum.ArrayValue)
+	case datum.RowValue != nil:
+		return decodeRow(field, column, *datum.RowValue)
+	default:
+		return decodeTimeSeries(field, column, datum.TimeSeriesValue)
+	}
+}
+
+// nestedColumn returns the nested column info selected by f, or an untyped column
+// when the type information is missing.
+func nestedColumn(column types.ColumnInfo, f func(*types.Type) *types.ColumnInfo) types.ColumnInfo {
+	if column.Type == nil || f(column.Type) == nil {
+		return types.ColumnInfo{}
+	}
+	return *f(column.Type)
+}
+
+func decodeArray(field reflect.Value, column types.ColumnInfo, values []types.Datum) error {
+	if field.Kind() != reflect.Slice {
+		return fmt.Errorf("cannot decode ARRAY into %s", field.Type())
+	}
+
+	elemColumn := nestedColumn(column, func(t *types.Type) *types.ColumnInfo { return t.ArrayColumnInfo })
+	slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+	for i, value := range values {
+		if err := decodeDatum(slice.Index(i), elemColumn, value); err != nil {
+			return fmt.Errorf("array element %d: %w", i, err)
+		}
+	}
+
+	field.Set(slice)
+	return nil
+}
+
+func decodeRow(field reflect.Value, column types.ColumnInfo, row types.Row) error {
+	if field.Kind() != reflect.Struct || field.Type() == timeType {
+		return fmt.Errorf("cannot decode ROW into %s", field.Type())
+	}
+
+	var columns []types.ColumnInfo
+	if column.Type != nil {
+		columns = column.Type.RowColumnInfo
+	}
+	if len(row.Data) != len(columns) {
+		return fmt.Errorf("mismatched length of row data and column info")
+	}
+
+	return unmarshalRow(row, columns, field, buildLookupTable(columns))
+}
+
+// decodeTimeSeries decodes every point as a row made of a time column followed by
+// either a value column or, when the measure value is a ROW that the target has no
+// value field for, the fields of that row.
+func decodeTimeSeries(field reflect.Value, column types.ColumnInfo, points []types.TimeSeriesDataPoint) error {
+	if field.Kind() != reflect.Slice || field.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode TIMESERIES into %s", field.Type())
+	}
+
+	elemType := field.Type().Elem()
+	valueColumn := nestedColumn(column, func(t *types.Type) *types.ColumnInfo { return t.TimeSeriesMeasureValueColumnInfo })
+	valueColumn.Name = aws.String("value")
+	hasValueField := hasColumnField(elemType, "value")
+
+	slice := reflect.MakeSlice(field.Type(), len(points), len(points))
+	for i, point := range points {
+		columns := []types.ColumnInfo{timestampColumn}
+		row := types.Row{Data: []types.Datum{{ScalarValue: point.Time}}}
+
+		switch {
+		case point.Value == nil:
+		case point.Value.RowValue != nil && !hasValueField:
+			if valueColumn.Type != nil {
+				columns = append(columns, valueColumn.Type.RowColumnInfo...)
+			}
+			row.Data = append(row.Data, point.Value.RowValue.Data...)
+		default:
+			columns = append(columns, valueColumn)
+			row.Data = append(row.Data, *point.Value)
+		}
+
+		if len(row.Data) != len(columns) {
+			return fmt.Errorf("time series point %d: mismatched length of row data and column info", i)
+		}
+		if err := unmarshalRow(row, columns, slice.Index(i), buildLookupTable(columns)); err != nil {
+			return fmt.Errorf("time series point %d: %w", i, err)
+		}
+	}
+
+	field.Set(slice)
+	return nil
+}
+
+// hasColumnField reports whether a field of t maps to the given column.
+func hasColumnField(t reflect.Type, column string) bool {
+	fields, err := columnFields(t)
+	if err != nil {
+		return false
+	}
+	for _, f := range fields {
+		if f.column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// checkColumnType reports whether values of the column can be decoded into a Go
+// value of type t, recursing into the element of ARRAY columns and the fields of
+// ROW columns.
+func checkColumnType(t reflect.Type, column types.ColumnInfo) error {
+	if column.Type == nil {
+		return nil
+	}
+
+	switch {
+	case column.Type.ArrayColumnInfo != nil:
+		t = indirectType(t)
+		if t.Kind() != reflect.Slice {
+			return fmt.Errorf("cannot decode ARRAY column into %s", t)
+		}
+		return checkColumnType(t.Elem(), *column.Type.ArrayColumnInfo)
+	case column.Type.RowColumnInfo != nil:
+		t = indirectType(t)
+		if t.Kind() != reflect.Struct || t == timeType {
+			return fmt.Errorf("cannot decode ROW column into %s", t)
+		}
+		return validateColumnTypes(t, column.Type.RowColumnInfo, buildLookupTable(column.Type.RowColumnInfo))
+	case column.Type.TimeSeriesMeasureValueColumnInfo != nil:
+		t = indirectType(t)
+		if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("cannot decode TIMESERIES column into %s", t)
+		}
+		if !hasColumnField(t.Elem(), timeColumn) {
+			return fmt.Errorf("cannot decode TIMESERIES column into %s without a time field", t)
+		}
+		return nil
+	case column.Type.ScalarType != "":
+		return checkScalarType(t, column.Type.ScalarType)
+	}
+	return nil
+}
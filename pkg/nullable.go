@@ -0,0 +1,68 @@
+package timestream
+
+import "reflect"
+
+// indirect follows pointers and sql.Null*-style wrappers down to the value they
+// hold. It reports false if a nil pointer or an invalid wrapper is met on the way,
+// meaning the value is missing, and for the zero Value of a field behind a nil
+// embedded pointer.
+func indirect(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return reflect.Value{}, false
+	}
+	for {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+			continue
+		}
+
+		i, ok := nullableValueIndex(v.Type())
+		if !ok {
+			return v, true
+		}
+		if !v.FieldByName("Valid").Bool() {
+			return reflect.Value{}, false
+		}
+		v = v.Field(i)
+	}
+}
+
+// indirectType returns the type indirect would reach for a value of type t.
+func indirectType(t reflect.Type) reflect.Type {
+	for {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+			continue
+		}
+
+		i, ok := nullableValueIndex(t)
+		if !ok {
+			return t
+		}
+		t = t.Field(i).Type
+	}
+}
+
+// nullableValueIndex reports whether t is shaped like the sql.Null* types, that is
+// a struct holding exactly one exported value field and an exported Valid bool,
+// and returns the index of the value field. Types with a custom codec are never
+// treated as wrappers.
+func nullableValueIndex(t reflect.Type) (int, bool) {
+	if t.Kind() != reflect.Struct || t.NumField() != 2 || hasCustomCodec(t) {
+		return -1, false
+	}
+
+	valid, ok := t.FieldByName("Valid")
+	if !ok || len(valid.Index) != 1 || !valid.IsExported() || valid.Type.Kind() != reflect.Bool {
+		return -1, false
+	}
+
+	i := 1 - valid.Index[0]
+	if !t.Field(i).IsExported() {
+		return -1, false
+	}
+	return i, true
+}
@@ -0,0 +1,84 @@
+package timestream
+
+import (
+	"reflect"
+	"sync"
+)
+
+// typeCache memoizes what is derived from a struct type alone, such as its parsed
+// tags and field indexes, so that tags are parsed and validated once per type
+// instead of once per record or row. It is safe for concurrent use.
+type typeCache[T any] struct {
+	m sync.Map // reflect.Type -> T
+}
+
+func (c *typeCache[T]) load(t reflect.Type, build func(reflect.Type) T) T {
+	if v, ok := c.m.Load(t); ok {
+		return v.(T)
+	}
+	v, _ := c.m.LoadOrStore(t, build(t))
+	return v.(T)
+}
+
+// reset empties the cache.
+func (c *typeCache[T]) reset() {
+	c.m.Range(func(k, _ any) bool {
+		c.m.Delete(k)
+		return true
+	})
+}
+
+// marshalPlan is the compiled form of a struct type for Marshal. Errors found in
+// the tags or field types are kept, and reported by every call for the type.
+type marshalPlan struct {
+	fields []taggedField
+	// mode is the measure mode selected by a mode field, empty when there is none.
+	mode MeasureMode
+	// appearanceErrs holds the outcome of validateAppearances for each mode.
+	appearanceErrs map[MeasureMode]error
+	err            error
+}
+
+var marshalPlans typeCache[*marshalPlan]
+
+func marshalPlanOf(t reflect.Type) *marshalPlan {
+	return marshalPlans.load(t, newMarshalPlan)
+}
+
+func newMarshalPlan(t reflect.Type) *marshalPlan {
+	w := newStructWalk(t)
+	fields, err := collectFields(t, w)
+	if err == nil {
+		err = validateTypes(w, fields)
+	}
+	if err != nil {
+		return &marshalPlan{err: err}
+	}
+
+	return &marshalPlan{
+		fields: fields,
+		mode:   measureModeTag(t),
+		appearanceErrs: map[MeasureMode]error{
+			MultiMeasure:  validateAppearances(w, fields, MultiMeasure),
+			SingleMeasure: validateAppearances(w, fields, SingleMeasure),
+		},
+	}
+}
+
+// columnPlan is the compiled form of a struct type for Unmarshal.
+type columnPlan struct {
+	fields []columnField
+	err    error
+}
+
+var columnPlans typeCache[columnPlan]
+
+// columnFields returns the fields of struct type t that Unmarshal decodes, walking
+// embedded and inlined structs the same way Marshal does.
+func columnFields(t reflect.Type) ([]columnField, error) {
+	plan := columnPlans.load(t, func(t reflect.Type) columnPlan {
+		fields, err := collectColumnFields(t, newStructWalk(t))
+		return columnPlan{fields: fields, err: err}
+	})
+	return plan.fields, plan.err
+}
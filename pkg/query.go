@@ -1,9 +1,26 @@
 package timestream
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// ErrMissingParameter is returned by BuildQuery when the template holds
+	// placeholders that no parameter is given for.
+	ErrMissingParameter = errors.New("missing parameters for placeholders")
+	// ErrUnusedParameter is returned by BuildQuery when parameters are given that
+	// the template holds no placeholder for.
+	ErrUnusedParameter = errors.New("parameters not found in query template")
 )
 
 // BuildQuery constructs a SQL query by replacing named placeholders
@@ -11,12 +28,36 @@ import (
 //
 // This function supports several types for parameter values: string, time.Time,
 // int, int64, and float64. The replacement process involves:
-// - Surrounding string values with single quotes.
-// - Formatting time.Time values as RFC3339 strings, also surrounded with single quotes.
-// - Directly inserting int, int64, and float64 values without additional formatting.
+// - Surrounding string values with single quotes, doubling the single quotes they hold.
+// - Formatting time.Time values as TIMESTAMP literals in UTC with nanosecond precision,
+// e.g. TIMESTAMP '2024-01-01 00:00:00.500000000'.
+// - Formatting time.Duration values as interval literals in the largest unit that holds
+// them exactly, e.g. 500ms or 2h, and negative ones in parentheses, e.g. (-5m).
+// - Directly inserting int, int64, and float64 values. NaN and infinite floats are
+// rejected.
+// - Surrounding DatabaseName and TableName values with double quotes, doubling the
+// double quotes they hold.
+// - Expanding slices of any of these types, such as []string or []TableName, into a
+// comma-separated list of their formatted elements, e.g. "site IN (:sites)". Empty
+// slices are rejected, as "IN ()" is not valid SQL, and so are byte slices.
+//
+// Any rendered value starting with a minus sign, such as a negative number or
+// duration, is wrapped in parentheses, e.g. (-1), so that the sign cannot start a
+// "--" comment after a minus in the template.
+//
+// Values implementing QueryParamFormatter render themselves, which overrides the
+// rendering of a single parameter, see DurationIn and TimeIn. This holds for slice
+// types too, which are then not expanded.
+//
+// Strings, database and table names holding control characters, such as newlines or
+// NUL, or invalid UTF-8 are rejected, as are empty database and table names.
 //
 // Placeholders in the template should be prefixed with a colon and followed by the key name.
 // For example, a placeholder for a "startTime" parameter should be written as ":startTime".
+// A placeholder spans the whole name, so ":site" does not match the start of ":site_id",
+// and may appear several times. Colons within quoted strings and identifiers, comments and
+// "::" casts are left alone. Placeholders are substituted in a single pass, so a value
+// holding ":name" is never substituted again.
 //
 // Parameters:
 //   - template: A SQL query template string containing named placeholders.
@@ -27,7 +68,8 @@ import (
 // Returns:
 //   - A string representing the final SQL query with all placeholders replaced by their
 //     respective values.
-//   - An error if any placeholder is not found in the template or if a parameter type is not supported.
+//   - An error if a parameter type is not supported, wrapping ErrMissingParameter if placeholders
+//     have no parameter, and ErrUnusedParameter if parameters have no placeholder in the template.
 //
 // Example:
 //
@@ -39,46 +81,363 @@ import (
 //
 // Note:
 //
-//	The function ensures basic SQL injection prevention by correctly formatting and escaping
-//	the parameter values based on their types. However, it's recommended to further validate
-//	and sanitise all input values as per your application's security requirements.
+//	The function prevents SQL injection through parameter values by escaping them based on
+//	their types, so that a value such as "O'Brien" is always read back as a single literal.
+//	It does not make the template itself safe, which must never be built from untrusted input.
 func BuildQuery(template string, params map[string]interface{}) (string, error) {
-	for key, value := range params {
-		placeholder := ":" + key
-
-		var replacement string
-
-		// Customise the replacement based on the type of value.
-		// This is crucial for proper formatting and escaping.
-		switch v := value.(type) {
-		case string:
-			replacement = fmt.Sprintf("'%s'", v) // Strings should be single-quoted
-		case time.Time:
-			replacement = fmt.Sprintf("from_unixtime(%s)", fmt.Sprint(v.Unix())) // Time should be formatted and single-quoted
-		case time.Duration:
-			a := int64(v.Seconds())
-			replacement = fmt.Sprintf("%ds", a) // Duration should be formatted and single-quoted
-		case int, int64, float64:
-			replacement = fmt.Sprintf("%v", v) // Numeric types can be used directly
-		case DatabaseName:
-			replacement = fmt.Sprintf(`"%s"`, string(v)) // Database name with double quotes
-		case TableName:
-			replacement = fmt.Sprintf(`"%s"`, string(v)) // Table name with double quotes
+	placeholders, err := parsePlaceholders(template)
+	if err != nil {
+		return "", err
+	}
 
-		default:
-			return "", fmt.Errorf("unsupported type for parameter %s", key)
+	query, used, missing, err := substitute(template, placeholders, func(name string) (interface{}, bool) {
+		value, ok := params[name]
+		return value, ok
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var unused []string
+	for key := range params {
+		if _, ok := used[key]; !ok {
+			unused = append(unused, key)
+		}
+	}
+	if err := parameterErrors(missing, unused); err != nil {
+		return "", err
+	}
+	return query, nil
+}
+
+// substitute replaces the placeholders of template with the rendering of the
+// value lookup returns for their name, in a single pass. It returns the rendering
+// of each value used, by name, and the placeholders lookup has no value for.
+func substitute(template string, placeholders []placeholder, lookup func(name string) (interface{}, bool)) (string, map[string]string, []string, error) {
+	var sb strings.Builder
+	var missing []string
+	used := make(map[string]string)
+	last := 0
+	for _, p := range placeholders {
+		replacement, ok := used[p.name]
+		if !ok {
+			value, found := lookup(p.name)
+			if !found {
+				if !slices.Contains(missing, ":"+p.name) {
+					missing = append(missing, ":"+p.name)
+				}
+				continue
+			}
+			var err error
+			if replacement, err = formatParam(p.name, value); err != nil {
+				return "", nil, nil, err
+			}
+			replacement = guardSign(replacement)
+			used[p.name] = replacement
+		}
+
+		sb.WriteString(template[last:p.start])
+		sb.WriteString(replacement)
+		last = p.end
+	}
+	sb.WriteString(template[last:])
+	return sb.String(), used, missing, nil
+}
+
+// parameterErrors reports placeholders without parameters, prefixed by a colon,
+// and parameters without placeholders.
+func parameterErrors(missing, unused []string) error {
+	sort.Strings(unused)
+
+	var errs error
+	if len(missing) > 0 {
+		errs = errors.Join(errs, fmt.Errorf("%w: %s", ErrMissingParameter, strings.Join(missing, ", ")))
+	}
+	if len(unused) > 0 {
+		errs = errors.Join(errs, fmt.Errorf("%w: %s", ErrUnusedParameter, strings.Join(unused, ", ")))
+	}
+	return errs
+}
+
+// formatParam renders a parameter value as SQL.
+func formatParam(key string, value interface{}) (string, error) {
+	// Formatters come first, as they may be slices rendering themselves.
+	if f, ok := value.(QueryParamFormatter); ok {
+		formatted, err := f.FormatQueryParam()
+		if err != nil {
+			return "", fmt.Errorf("invalid value for parameter %s: %w", key, err)
+		}
+		return formatted, nil
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice {
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return "", fmt.Errorf("unsupported type for parameter %s: %s, convert it to a string", key, v.Type())
+		}
+		return formatList(key, v)
+	}
+
+	// Customise the replacement based on the type of value.
+	// This is crucial for proper formatting and escaping.
+	switch v := value.(type) {
+	case string:
+		quoted, err := quoteString(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid value for parameter %s: %w", key, err)
+		}
+		return quoted, nil
+	case time.Time:
+		return formatTimestamp(v), nil
+	case time.Duration:
+		return formatDuration(v), nil
+	case int, int64:
+		return fmt.Sprintf("%d", v), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("invalid value for parameter %s: %v is not a finite number", key, v)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case DatabaseName, TableName:
+		quoted, err := quoteIdentifier(fmt.Sprint(v))
+		if err != nil {
+			return "", fmt.Errorf("invalid value for parameter %s: %w", key, err)
+		}
+		return quoted, nil
+	default:
+		return "", fmt.Errorf("unsupported type for parameter %s", key)
+	}
+}
+
+// guardSign parenthesizes a rendered value starting with a minus sign, such as a
+// negative number or duration, so that it cannot join a preceding minus into a
+// "--" comment, as in "a >-:x" with a negative x.
+func guardSign(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// formatList renders the elements of a slice parameter as a comma-separated list,
+// for use within the parentheses of an IN predicate.
+func formatList(key string, v reflect.Value) (string, error) {
+	if v.Len() == 0 {
+		return "", fmt.Errorf("parameter %s is an empty slice, which cannot form an IN list", key)
+	}
+
+	elems := make([]string, v.Len())
+	for i := range elems {
+		elem := v.Index(i)
+		if _, ok := elem.Interface().(QueryParamFormatter); !ok && elem.Kind() == reflect.Slice {
+			return "", fmt.Errorf("unsupported type for parameter %s: nested slice", key)
+		}
+
+		var err error
+		if elems[i], err = formatParam(fmt.Sprintf("%s[%d]", key, i), elem.Interface()); err != nil {
+			return "", err
 		}
+		elems[i] = guardSign(elems[i])
+	}
+	return strings.Join(elems, ", "), nil
+}
 
-		if !strings.Contains(template, placeholder) {
-			return "", fmt.Errorf("placeholder %s not found in query template", placeholder)
+// placeholder is a :name placeholder of a query template, spanning
+// template[start:end].
+type placeholder struct {
+	name       string
+	start, end int
+}
+
+// parsePlaceholders returns the placeholders of a query template in order. A
+// placeholder is a colon followed by a name made of letters, digits and
+// underscores, and extends to the end of that name, so that :site never matches
+// the start of :site_id. Single-quoted strings, double-quoted identifiers,
+// comments and :: casts are skipped.
+func parsePlaceholders(template string) ([]placeholder, error) {
+	var placeholders []placeholder
+	for i := 0; i < len(template); {
+		switch {
+		case template[i] == '\'' || template[i] == '"':
+			end, err := skipQuoted(template, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case strings.HasPrefix(template[i:], "--"):
+			end := strings.IndexByte(template[i:], '\n')
+			if end < 0 {
+				return placeholders, nil
+			}
+			i += end + 1
+		case strings.HasPrefix(template[i:], "/*"):
+			end := strings.Index(template[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment at offset %d in query template", i)
+			}
+			i += end + 4
+		case strings.HasPrefix(template[i:], "::"):
+			i += 2
+			for i < len(template) && isIdentByte(template[i]) {
+				i++
+			}
+		case template[i] == ':' && i+1 < len(template) && isIdentByte(template[i+1]) && !isDigit(template[i+1]):
+			end := i + 1
+			for end < len(template) && isIdentByte(template[end]) {
+				end++
+			}
+			placeholders = append(placeholders, placeholder{name: template[i+1 : end], start: i, end: end})
+			i = end
+		default:
+			i++
 		}
+	}
+	return placeholders, nil
+}
 
-		template = strings.ReplaceAll(template, placeholder, replacement)
+// skipQuoted returns the offset following the quoted text starting at offset start,
+// where a doubled quote stands for the quote itself.
+func skipQuoted(template string, start int) (int, error) {
+	quote := template[start]
+	for i := start + 1; i < len(template); i++ {
+		if template[i] != quote {
+			continue
+		}
+		if i+1 < len(template) && template[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1, nil
 	}
-	return template, nil
+	return 0, fmt.Errorf("unterminated quoted text at offset %d in query template", start)
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || isDigit(b) || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
 }
 
 type (
 	DatabaseName string
 	TableName    string
 )
+
+// quoteString renders s as a SQL string literal, doubling the single quotes it holds.
+func quoteString(s string) (string, error) {
+	if err := checkQuotable(s); err != nil {
+		return "", err
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+}
+
+// quoteIdentifier renders s as a quoted SQL identifier, doubling the double quotes
+// it holds.
+func quoteIdentifier(s string) (string, error) {
+	if s == "" {
+		return "", fmt.Errorf("empty identifier")
+	}
+	if err := checkQuotable(s); err != nil {
+		return "", err
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`, nil
+}
+
+// checkQuotable rejects text that quoting alone cannot make safe: invalid UTF-8,
+// which may be read differently than it was escaped, and control characters, which
+// no legitimate name or dimension value holds.
+func checkQuotable(s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("invalid UTF-8 in %q", s)
+	}
+	for i, r := range s {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("control character %U at offset %d", r, i)
+		}
+	}
+	return nil
+}
+
+// QueryParamFormatter is implemented by BuildQuery parameters that render
+// themselves as SQL. Implementations are responsible for escaping what they render.
+type QueryParamFormatter interface {
+	FormatQueryParam() (string, error)
+}
+
+// queryParamFunc adapts a function to QueryParamFormatter.
+type queryParamFunc func() (string, error)
+
+func (f queryParamFunc) FormatQueryParam() (string, error) {
+	return f()
+}
+
+// durationUnits are the units of Timestream interval literals, largest first.
+var durationUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+	{"us", time.Microsecond},
+	{"ns", time.Nanosecond},
+}
+
+// formatDuration renders d in the largest unit that holds it exactly, wrapping
+// negative durations in parentheses, e.g. (-5m).
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+	for _, u := range durationUnits {
+		if d%u.unit == 0 {
+			return guardSign(fmt.Sprintf("%d%s", d/u.unit, u.suffix))
+		}
+	}
+	return guardSign(fmt.Sprintf("%dns", d))
+}
+
+// formatTimestamp renders t as a TIMESTAMP literal in UTC, at nanosecond precision.
+func formatTimestamp(t time.Time) string {
+	return fmt.Sprintf("TIMESTAMP '%s'", t.UTC().Format("2006-01-02 15:04:05.000000000"))
+}
+
+// DurationIn overrides the unit a duration parameter is rendered in, for instance
+// to keep a query stable across values: DurationIn(2*time.Hour, "m") renders 120m.
+// The unit is one of "ns", "us", "ms", "s", "m", "h" and "d", and the duration must
+// be a whole number of units. Negative durations are wrapped in parentheses, e.g.
+// (-120m), as for plain duration parameters.
+func DurationIn(d time.Duration, unit string) QueryParamFormatter {
+	return queryParamFunc(func() (string, error) {
+		for _, u := range durationUnits {
+			if u.suffix != unit {
+				continue
+			}
+			if d%u.unit != 0 {
+				return "", fmt.Errorf("duration %s is not a whole number of %s", d, unit)
+			}
+			return guardSign(fmt.Sprintf("%d%s", d/u.unit, unit)), nil
+		}
+		return "", fmt.Errorf("unsupported unit for duration: %s", unit)
+	})
+}
+
+// TimeIn overrides the rendering of a time parameter, truncating it to the given
+// unit: "s" renders from_unixtime(seconds), "ms" from_milliseconds(milliseconds) and
+// "ns" from_nanoseconds(nanoseconds).
+func TimeIn(t time.Time, unit string) QueryParamFormatter {
+	return queryParamFunc(func() (string, error) {
+		switch unit {
+		case "s":
+			return fmt.Sprintf("from_unixtime(%d)", t.Unix()), nil
+		case "ms":
+			return fmt.Sprintf("from_milliseconds(%d)", t.UnixMilli()), nil
+		case "ns":
+			return fmt.Sprintf("from_nanoseconds(%d)", t.UnixNano()), nil
+		default:
+			return "", fmt.Errorf("unsupported unit for time: %s", unit)
+		}
+	})
+}
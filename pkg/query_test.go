@@ -1,10 +1,15 @@
 package timestream_test
 
 import (
+	"context"
+	"errors"
+	"math"
+	"strings"
 	"testing"
 	"time"
 
 	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/EvergenEnergy/TimeSchema/pkg/timestreamtest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,7 +55,7 @@ func TestBuildQuery(t *testing.T) {
 				template: "SELECT * FROM my_table WHERE name = :name AND timestamp = :timestamp AND id = :id",
 				params:   map[string]interface{}{"name": "test", "timestamp": fixedNow, "id": 1},
 			},
-			want: "SELECT * FROM my_table WHERE name = 'test' AND timestamp = from_unixtime(1704067200) AND id = 1",
+			want: "SELECT * FROM my_table WHERE name = 'test' AND timestamp = TIMESTAMP '2024-01-01 00:00:00.000000000' AND id = 1",
 		},
 		{
 			name: "test time",
@@ -58,7 +63,7 @@ func TestBuildQuery(t *testing.T) {
 				template: "SELECT * FROM my_table WHERE name = :name AND timestamp BETWEEN :yesterday AND :now",
 				params:   map[string]interface{}{"name": "test", "yesterday": fixedNow.Add(-24 * time.Hour), "now": fixedNow},
 			},
-			want: "SELECT * FROM my_table WHERE name = 'test' AND timestamp BETWEEN from_unixtime(1703980800) AND from_unixtime(1704067200)",
+			want: "SELECT * FROM my_table WHERE name = 'test' AND timestamp BETWEEN TIMESTAMP '2023-12-31 00:00:00.000000000' AND TIMESTAMP '2024-01-01 00:00:00.000000000'",
 		},
 		{
 			name: "test duration",
@@ -66,7 +71,7 @@ func TestBuildQuery(t *testing.T) {
 				template: "SELECT * FROM my_table WHERE name = :name AND timestamp BETWEEN ago(:yesterday) AND ago(:now)",
 				params:   map[string]interface{}{"name": "test", "yesterday": (24 * time.Hour), "now": 1 * time.Second},
 			},
-			want: "SELECT * FROM my_table WHERE name = 'test' AND timestamp BETWEEN ago(86400s) AND ago(1s)",
+			want: "SELECT * FROM my_table WHERE name = 'test' AND timestamp BETWEEN ago(1d) AND ago(1s)",
 		},
 		{
 			name: "test table name",
@@ -96,3 +101,397 @@ func TestBuildQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildQueryEscaping(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{
+			name:   "doubles single quotes in strings",
+			params: map[string]interface{}{"site": "O'Brien"},
+			want:   `SELECT * FROM "db"."readings" WHERE site = 'O''Brien'`,
+		},
+		{
+			name:   "keeps injected predicates inside the literal",
+			params: map[string]interface{}{"site": "x' OR '1'='1"},
+			want:   `SELECT * FROM "db"."readings" WHERE site = 'x'' OR ''1''=''1'`,
+		},
+		{
+			name:   "keeps injected statements inside the literal",
+			params: map[string]interface{}{"site": "'; DROP TABLE readings; --"},
+			want:   `SELECT * FROM "db"."readings" WHERE site = '''; DROP TABLE readings; --'`,
+		},
+		{
+			name:   "leaves backslashes alone",
+			params: map[string]interface{}{"site": `\' OR 1=1 --`},
+			want:   `SELECT * FROM "db"."readings" WHERE site = '\'' OR 1=1 --'`,
+		},
+		{
+			name:   "keeps unicode",
+			params: map[string]interface{}{"site": "Zürich ʼ ’"},
+			want:   `SELECT * FROM "db"."readings" WHERE site = 'Zürich ʼ ’'`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timestream.BuildQuery(`SELECT * FROM "db"."readings" WHERE site = :site`, tt.params)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("doubles double quotes in identifiers", func(t *testing.T) {
+		got, err := timestream.BuildQuery("SELECT * FROM :db.:table", map[string]interface{}{
+			"db":    timestream.DatabaseName(`my"db`),
+			"table": timestream.TableName(`readings" WHERE 1=1 --`),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT * FROM "my""db"."readings"" WHERE 1=1 --"`, got)
+	})
+
+	t.Run("parenthesizes negative numbers", func(t *testing.T) {
+		for _, value := range []interface{}{-1, int64(-1), -1.5} {
+			got, err := timestream.BuildQuery("SELECT * FROM t WHERE a >-:x AND site = 'a'", map[string]interface{}{"x": value})
+			assert.NoError(t, err)
+			assert.NotContains(t, got, "--")
+			assert.Regexp(t, `^SELECT \* FROM t WHERE a >-\(-1(\.5)?\) AND site = 'a'$`, got)
+		}
+	})
+
+	t.Run("parenthesizes negative durations", func(t *testing.T) {
+		got, err := timestream.BuildQuery("SELECT * FROM t WHERE time > now() -:d AND site = :s", map[string]interface{}{
+			"d": -5 * time.Minute,
+			"s": "x",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM t WHERE time > now() -(-5m) AND site = 'x'", got)
+
+		formatted, err := timestream.DurationIn(-2*time.Hour, "m").FormatQueryParam()
+		assert.NoError(t, err)
+		assert.Equal(t, "(-120m)", formatted, "the formatter is safe outside BuildQuery too")
+	})
+
+	t.Run("parenthesizes every value starting with a minus", func(t *testing.T) {
+		tests := []struct {
+			value interface{}
+			want  string
+		}{
+			{value: -5 * time.Minute, want: "(-5m)"},
+			{value: timestream.DurationIn(-2*time.Hour, "m"), want: "(-120m)"},
+			{value: rawParam("-1"), want: "(-1)"},
+			{value: []rawParam{"-1", "-2"}, want: "(-1), (-2)"},
+		}
+		for _, tt := range tests {
+			got, err := timestream.BuildQuery("SELECT * FROM t WHERE time > now() -:d AND site = :s", map[string]interface{}{"d": tt.value, "s": "x"})
+			assert.NoError(t, err)
+			assert.Equal(t, "SELECT * FROM t WHERE time > now() -"+tt.want+" AND site = 'x'", got)
+		}
+	})
+}
+
+func TestBuildQueryRejectsUnsafeValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "newline in string", value: "site-1\n--"},
+		{name: "NUL in string", value: "site-1\x00' OR 1=1"},
+		{name: "carriage return in string", value: "site\r"},
+		{name: "tab in string", value: "site\t1"},
+		{name: "DEL in string", value: "site\x7f"},
+		{name: "C1 control in string", value: "site\u0085"},
+		{name: "invalid UTF-8 in string", value: "site\xc0'"},
+		{name: "newline in table name", value: timestream.TableName("readings\n")},
+		{name: "empty table name", value: timestream.TableName("")},
+		{name: "empty database name", value: timestream.DatabaseName("")},
+		{name: "NaN", value: math.NaN()},
+		{name: "positive infinity", value: math.Inf(1)},
+		{name: "negative infinity", value: math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timestream.BuildQuery("SELECT * FROM t WHERE x = :value", map[string]interface{}{"value": tt.value})
+			assert.Error(t, err)
+			assert.Empty(t, got)
+		})
+	}
+}
+
+func TestBuildQueryEscapingEmulated(t *testing.T) {
+	emulator := timestreamtest.NewEmulator()
+	ctx := context.Background()
+	setupEmulator(t, emulator)
+
+	readings := newWriterReadings(2)
+	readings[0].Site = "O'Brien"
+	readings[1].Site = "x"
+	w := timestream.NewWriter(emulator, "db")
+	assert.NoError(t, w.Write(ctx, "readings", readings))
+	assert.NoError(t, w.Close(ctx))
+
+	tests := []struct {
+		site string
+		want int
+	}{
+		{site: "O'Brien", want: 1},
+		{site: "x' OR '1'='1", want: 0},
+		{site: "x' OR site <> '", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.site, func(t *testing.T) {
+			query, err := timestream.BuildQuery("SELECT site FROM :db.:table WHERE site = :site", map[string]interface{}{
+				"db":    timestream.DatabaseName("db"),
+				"table": timestream.TableName("readings"),
+				"site":  tt.site,
+			})
+			assert.NoError(t, err)
+
+			rows, err := timestream.Query[map[string]any](ctx, emulator, query)
+			assert.NoError(t, err)
+			assert.Len(t, rows, tt.want)
+			for _, row := range rows {
+				assert.Equal(t, tt.site, row["site"])
+			}
+		})
+	}
+}
+
+func TestBuildQueryPlaceholders(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		params   map[string]interface{}
+		want     string
+	}{
+		{
+			name:     "matches whole names only",
+			template: "SELECT * FROM t WHERE site = :site AND site_id = :site_id",
+			params:   map[string]interface{}{"site": "a", "site_id": 1},
+			want:     "SELECT * FROM t WHERE site = 'a' AND site_id = 1",
+		},
+		{
+			name:     "substitutes repeated placeholders",
+			template: "SELECT * FROM t WHERE a = :v OR b = :v",
+			params:   map[string]interface{}{"v": 1},
+			want:     "SELECT * FROM t WHERE a = 1 OR b = 1",
+		},
+		{
+			name:     "does not substitute values again",
+			template: "SELECT * FROM t WHERE a = :a AND b = :b",
+			params:   map[string]interface{}{"a": ":b", "b": ":a"},
+			want:     "SELECT * FROM t WHERE a = ':b' AND b = ':a'",
+		},
+		{
+			name:     "skips quoted strings",
+			template: "SELECT * FROM t WHERE label = ':site' AND note = 'it''s :site' AND site = :site",
+			params:   map[string]interface{}{"site": "a"},
+			want:     "SELECT * FROM t WHERE label = ':site' AND note = 'it''s :site' AND site = 'a'",
+		},
+		{
+			name:     "skips quoted identifiers",
+			template: `SELECT ":site", "a"":site" FROM t WHERE site = :site`,
+			params:   map[string]interface{}{"site": "a"},
+			want:     `SELECT ":site", "a"":site" FROM t WHERE site = 'a'`,
+		},
+		{
+			name:     "skips casts",
+			template: "SELECT power::double, time::timestamp FROM t WHERE power > :power::double",
+			params:   map[string]interface{}{"power": 1},
+			want:     "SELECT power::double, time::timestamp FROM t WHERE power > 1::double",
+		},
+		{
+			name:     "skips comments",
+			template: "SELECT * FROM t -- filter on :site\nWHERE site = :site /* not :other */",
+			params:   map[string]interface{}{"site": "a"},
+			want:     "SELECT * FROM t -- filter on :site\nWHERE site = 'a' /* not :other */",
+		},
+		{
+			name:     "ignores colons followed by digits",
+			template: "SELECT * FROM t WHERE a = :a AND b = '12:30' AND c = 1:2",
+			params:   map[string]interface{}{"a": 1},
+			want:     "SELECT * FROM t WHERE a = 1 AND b = '12:30' AND c = 1:2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timestream.BuildQuery(tt.template, tt.params)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBuildQueryPlaceholderErrors(t *testing.T) {
+	t.Run("reports missing and unused parameters", func(t *testing.T) {
+		got, err := timestream.BuildQuery("SELECT * FROM t WHERE a = :a AND b = :b AND c = :c AND a2 = :a", map[string]interface{}{
+			"b": 1, "y": 2, "x": 3,
+		})
+		assert.Empty(t, got)
+		assert.ErrorIs(t, err, timestream.ErrMissingParameter)
+		assert.ErrorIs(t, err, timestream.ErrUnusedParameter)
+		assert.EqualError(t, err, "missing parameters for placeholders: :a, :c\nparameters not found in query template: x, y")
+	})
+
+	t.Run("reports placeholders only found in quoted text as unused", func(t *testing.T) {
+		_, err := timestream.BuildQuery("SELECT * FROM t WHERE a = ':a'", map[string]interface{}{"a": 1})
+		assert.ErrorIs(t, err, timestream.ErrUnusedParameter)
+		assert.False(t, errors.Is(err, timestream.ErrMissingParameter))
+	})
+
+	t.Run("rejects unterminated quotes and comments", func(t *testing.T) {
+		for _, template := range []string{
+			"SELECT * FROM t WHERE a = ':a",
+			`SELECT * FROM "t WHERE a = :a`,
+			"SELECT * FROM t WHERE a = :a /* :b",
+		} {
+			_, err := timestream.BuildQuery(template, map[string]interface{}{"a": 1})
+			assert.Error(t, err, template)
+		}
+	})
+}
+
+// rawParam renders itself as is.
+type rawParam string
+
+func (p rawParam) FormatQueryParam() (string, error) {
+	return string(p), nil
+}
+
+// joinedSites renders itself as a single comma-separated string literal.
+type joinedSites []string
+
+func (s joinedSites) FormatQueryParam() (string, error) {
+	return "'" + strings.Join(s, ",") + "'", nil
+}
+
+func TestBuildQuerySlices(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "strings", value: []string{"a", "O'Brien"}, want: "SELECT * FROM t WHERE x IN ('a', 'O''Brien')"},
+		{name: "ints", value: []int{1, -2}, want: "SELECT * FROM t WHERE x IN (1, (-2))"},
+		{name: "int64s", value: []int64{3}, want: "SELECT * FROM t WHERE x IN (3)"},
+		{name: "float64s", value: []float64{1.5, 2}, want: "SELECT * FROM t WHERE x IN (1.5, 2)"},
+		{
+			name:  "times",
+			value: []time.Time{fixedNow, fixedNow.Add(time.Hour)},
+			want:  "SELECT * FROM t WHERE x IN (TIMESTAMP '2024-01-01 00:00:00.000000000', TIMESTAMP '2024-01-01 01:00:00.000000000')",
+		},
+		{name: "table names", value: []timestream.TableName{"a", `b"c`}, want: `SELECT * FROM t WHERE x IN ("a", "b""c")`},
+		{name: "database names", value: []timestream.DatabaseName{"db"}, want: `SELECT * FROM t WHERE x IN ("db")`},
+		{name: "mixed values", value: []interface{}{"a", 1}, want: "SELECT * FROM t WHERE x IN ('a', 1)"},
+		{name: "formatter slice", value: joinedSites{"a", "b"}, want: "SELECT * FROM t WHERE x IN ('a,b')"},
+		{name: "slice of formatter slices", value: []joinedSites{{"a"}, {"b", "c"}}, want: "SELECT * FROM t WHERE x IN ('a', 'b,c')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timestream.BuildQuery("SELECT * FROM t WHERE x IN (:values)", map[string]interface{}{"values": tt.value})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	failures := []struct {
+		name    string
+		value   interface{}
+		wantErr string
+	}{
+		{name: "empty slice", value: []string{}, wantErr: "parameter values is an empty slice, which cannot form an IN list"},
+		{name: "nil slice", value: []int(nil), wantErr: "parameter values is an empty slice, which cannot form an IN list"},
+		{name: "unsafe element", value: []string{"a", "b\n"}, wantErr: "invalid value for parameter values[1]: control character U+000A at offset 1"},
+		{name: "unsupported element", value: []bool{true}, wantErr: "unsupported type for parameter values[0]"},
+		{name: "nested slice", value: [][]string{{"a"}}, wantErr: "unsupported type for parameter values: nested slice"},
+		{name: "byte slice", value: []byte("a"), wantErr: "unsupported type for parameter values: []uint8, convert it to a string"},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timestream.BuildQuery("SELECT * FROM t WHERE x IN (:values)", map[string]interface{}{"values": tt.value})
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Empty(t, got)
+		})
+	}
+}
+
+func TestBuildQueryTimes(t *testing.T) {
+	precise := time.Date(2024, 1, 1, 10, 30, 15, 123456789, time.FixedZone("AEST", 10*60*60))
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "time in UTC with nanoseconds", value: precise, want: "TIMESTAMP '2024-01-01 00:30:15.123456789'"},
+		{name: "milliseconds are kept", value: fixedNow.Add(500 * time.Millisecond), want: "TIMESTAMP '2024-01-01 00:00:00.500000000'"},
+		{name: "days", value: 48 * time.Hour, want: "2d"},
+		{name: "hours", value: 36 * time.Hour, want: "36h"},
+		{name: "minutes", value: 90 * time.Minute, want: "90m"},
+		{name: "seconds", value: 61 * time.Second, want: "61s"},
+		{name: "milliseconds", value: 500 * time.Millisecond, want: "500ms"},
+		{name: "microseconds", value: 1500 * time.Microsecond, want: "1500us"},
+		{name: "nanoseconds", value: time.Second + time.Nanosecond, want: "1000000001ns"},
+		{name: "negative", value: -2 * time.Hour, want: "(-2h)"},
+		{name: "zero", value: time.Duration(0), want: "0s"},
+		{name: "duration override", value: timestream.DurationIn(2*time.Hour, "m"), want: "120m"},
+		{name: "duration override in days", value: timestream.DurationIn(48*time.Hour, "d"), want: "2d"},
+		{name: "negative duration override", value: timestream.DurationIn(-2*time.Hour, "m"), want: "(-120m)"},
+		{name: "time override in seconds", value: timestream.TimeIn(precise, "s"), want: "from_unixtime(1704069015)"},
+		{name: "time override in milliseconds", value: timestream.TimeIn(precise, "ms"), want: "from_milliseconds(1704069015123)"},
+		{name: "time override in nanoseconds", value: timestream.TimeIn(precise, "ns"), want: "from_nanoseconds(1704069015123456789)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timestream.BuildQuery("SELECT :v", map[string]interface{}{"v": tt.value})
+			assert.NoError(t, err)
+			assert.Equal(t, "SELECT "+tt.want, got)
+		})
+	}
+
+	failures := []struct {
+		name    string
+		value   interface{}
+		wantErr string
+	}{
+		{name: "duration not a whole number of units", value: timestream.DurationIn(90*time.Second, "m"), wantErr: "invalid value for parameter v: duration 1m30s is not a whole number of m"},
+		{name: "unknown duration unit", value: timestream.DurationIn(time.Hour, "w"), wantErr: "invalid value for parameter v: unsupported unit for duration: w"},
+		{name: "unknown time unit", value: timestream.TimeIn(fixedNow, "us"), wantErr: "invalid value for parameter v: unsupported unit for time: us"},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := timestream.BuildQuery("SELECT :v", map[string]interface{}{"v": tt.value})
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestBuildQueryTimesEmulated(t *testing.T) {
+	emulator := timestreamtest.NewEmulator()
+	ctx := context.Background()
+	setupEmulator(t, emulator)
+
+	// Readings half a second apart, which whole seconds cannot tell apart.
+	start := now.Truncate(time.Millisecond)
+	readings := newWriterReadings(3)
+	for i := range readings {
+		readings[i].Timestamp = start.Add(time.Duration(i) * 500 * time.Millisecond)
+	}
+	w := timestream.NewWriter(emulator, "db")
+	assert.NoError(t, w.Write(ctx, "readings", readings))
+	assert.NoError(t, w.Close(ctx))
+
+	for _, from := range []interface{}{
+		start.Add(500 * time.Millisecond),
+		timestream.TimeIn(start.Add(500*time.Millisecond), "ms"),
+		timestream.TimeIn(start.Add(500*time.Millisecond), "ns"),
+	} {
+		query, err := timestream.BuildQuery(`SELECT power FROM "db"."readings" WHERE time >= :from`, map[string]interface{}{"from": from})
+		assert.NoError(t, err)
+
+		rows, err := timestream.Query[map[string]any](ctx, emulator, query)
+		assert.NoError(t, err)
+		assert.Len(t, rows, 2, query)
+	}
+}
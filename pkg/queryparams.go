@@ -0,0 +1,280 @@
+package timestream
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// paramField is a struct field holding the parameter of a query placeholder.
+type paramField struct {
+	name  string
+	index []int
+}
+
+// paramPlan is the compiled form of a struct type for BuildQueryFrom.
+type paramPlan struct {
+	fields map[string]paramField
+	err    error
+}
+
+var paramPlans typeCache[paramPlan]
+
+// paramFields returns the fields of struct type t tagged with `param`, by name,
+// walking untagged embedded structs.
+func paramFields(t reflect.Type) (map[string]paramField, error) {
+	plan := paramPlans.load(t, func(t reflect.Type) paramPlan {
+		fields := make(map[string]paramField)
+		err := collectParamFields(t, newStructWalk(t), fields)
+		return paramPlan{fields: fields, err: err}
+	})
+	return plan.fields, plan.err
+}
+
+func collectParamFields(t reflect.Type, w structWalk, fields map[string]paramField) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, tagged := field.Tag.Lookup("param")
+		index, path := w.at(i, field)
+
+		if !tagged {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				nested, err := w.nested(i, field, "")
+				if err != nil {
+					return err
+				}
+				if err := collectParamFields(field.Type, nested, fields); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if tag == "-" {
+			continue
+		}
+
+		switch {
+		case !field.IsExported():
+			return w.tagError(path, tag, fmt.Errorf("field is not accessible, needs to be public"))
+		case !isPlaceholderName(tag):
+			return w.tagError(path, tag, fmt.Errorf("parameter name must be a placeholder name"))
+		}
+		if _, ok := fields[tag]; ok {
+			return w.tagError(path, tag, fmt.Errorf("duplicate parameter %s", tag))
+		}
+		if err := checkParamType(field.Type); err != nil {
+			return w.tagError(path, tag, err)
+		}
+		fields[tag] = paramField{name: tag, index: index}
+	}
+	return nil
+}
+
+var formatterType = reflect.TypeOf((*QueryParamFormatter)(nil)).Elem()
+
+// paramScalarTypes are the types formatParam renders other than formatters and
+// slices.
+var paramScalarTypes = map[reflect.Type]bool{
+	reflect.TypeOf(""):               true,
+	reflect.TypeOf(0):                true,
+	reflect.TypeOf(int64(0)):         true,
+	reflect.TypeOf(0.0):              true,
+	reflect.TypeOf(time.Time{}):      true,
+	reflect.TypeOf(time.Duration(0)): true,
+	reflect.TypeOf(DatabaseName("")): true,
+	reflect.TypeOf(TableName("")):    true,
+}
+
+// checkParamType checks that formatParam can render the values of a field of type
+// t: a QueryParamFormatter, a supported scalar or a slice of either.
+func checkParamType(t reflect.Type) error {
+	if t.Implements(formatterType) || paramScalarTypes[t] {
+		return nil
+	}
+	if t.Kind() == reflect.Slice {
+		elem := t.Elem()
+		switch {
+		case elem.Kind() == reflect.Uint8:
+			return fmt.Errorf("unsupported type %s for a query parameter, use a string", t)
+		case elem.Implements(formatterType) || paramScalarTypes[elem]:
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported type %s for a query parameter", t)
+}
+
+// isPlaceholderName reports whether ":"+name is read as a placeholder for name.
+func isPlaceholderName(name string) bool {
+	if name == "" || isDigit(name[0]) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isIdentByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// paramStruct returns the struct type of the parameters of BuildQueryFrom or
+// PrepareQuery, t itself or the type it points to.
+func paramStruct(t reflect.Type) (reflect.Type, error) {
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params must be a struct, got %v", t)
+	}
+	return t, nil
+}
+
+// paramValue returns the struct value of params, or an error if it is a nil
+// pointer.
+func paramValue(params reflect.Value) (reflect.Value, error) {
+	if params.Kind() == reflect.Pointer {
+		if params.IsNil() {
+			return reflect.Value{}, fmt.Errorf("params is nil")
+		}
+		params = params.Elem()
+	}
+	return params, nil
+}
+
+// lookupParam returns the lookup of substitute reading the fields of params.
+func lookupParam(params reflect.Value, fields map[string]paramField) func(string) (interface{}, bool) {
+	return func(name string) (interface{}, bool) {
+		f, ok := fields[name]
+		if !ok {
+			return nil, false
+		}
+		return params.FieldByIndex(f.index).Interface(), true
+	}
+}
+
+// BuildQueryFrom constructs a SQL query like BuildQuery, reading the parameters
+// from the fields of params, a struct or a pointer to a struct, instead of a map.
+// Each field holding a parameter is tagged with the name of its placeholder:
+//
+//	type readingsParams struct {
+//	    Sites []string      `param:"sites"`
+//	    From  time.Time     `param:"from"`
+//	    Bin   time.Duration `param:"bin"`
+//	}
+//
+//	query, err := BuildQueryFrom(`SELECT bin(time, :bin), avg(power) FROM "db"."readings"
+//	    WHERE site IN (:sites) AND time >= :from GROUP BY 1`, readingsParams{...})
+//
+// Fields hold the types BuildQuery renders, rendered the same way: string, int,
+// int64, float64, time.Time, time.Duration, DatabaseName, TableName, types
+// implementing QueryParamFormatter, and slices of them. Untagged fields and fields
+// tagged `param:"-"` are ignored, and the fields of untagged embedded structs are
+// read as fields of params. Tags and field types are checked once per struct type,
+// and other field types are reported as a *TagError.
+//
+// As with BuildQuery, the returned error wraps ErrMissingParameter if placeholders
+// have no field, and ErrUnusedParameter if fields have no placeholder. Use
+// PrepareQuery to check these once for a template used many times.
+func BuildQueryFrom(template string, params any) (string, error) {
+	t, err := paramStruct(reflect.TypeOf(params))
+	if err != nil {
+		return "", err
+	}
+	fields, err := paramFields(t)
+	if err != nil {
+		return "", err
+	}
+	val, err := paramValue(reflect.ValueOf(params))
+	if err != nil {
+		return "", err
+	}
+
+	placeholders, err := parsePlaceholders(template)
+	if err != nil {
+		return "", err
+	}
+	query, used, missing, err := substitute(template, placeholders, lookupParam(val, fields))
+	if err != nil {
+		return "", err
+	}
+
+	var unused []string
+	for name := range fields {
+		if _, ok := used[name]; !ok {
+			unused = append(unused, name)
+		}
+	}
+	if err := parameterErrors(missing, unused); err != nil {
+		return "", err
+	}
+	return query, nil
+}
+
+// PreparedQuery is a query template whose placeholders have been checked against
+// the `param` fields of a struct type T, as read by BuildQueryFrom. Building the
+// query only renders the parameters. It is safe for concurrent use.
+//
+// Example usage, preparing the queries of a service at startup:
+//
+//	readingsQuery, err := PrepareQuery[readingsParams](`SELECT ...`)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	// ...
+//	query, err := readingsQuery.Build(readingsParams{...})
+type PreparedQuery[T any] struct {
+	template     string
+	placeholders []placeholder
+	fields       map[string]paramField
+}
+
+// PrepareQuery parses template and checks that T, a struct or a pointer to a
+// struct, has a field for every placeholder and a placeholder for every field,
+// returning the errors BuildQueryFrom would return for every value of T.
+func PrepareQuery[T any](template string) (*PreparedQuery[T], error) {
+	t, err := paramStruct(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	fields, err := paramFields(t)
+	if err != nil {
+		return nil, err
+	}
+	placeholders, err := parsePlaceholders(template)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing, unused []string
+	found := make(map[string]bool, len(placeholders))
+	for _, p := range placeholders {
+		if _, ok := fields[p.name]; !ok && !found[p.name] {
+			missing = append(missing, ":"+p.name)
+		}
+		found[p.name] = true
+	}
+	for name := range fields {
+		if !found[name] {
+			unused = append(unused, name)
+		}
+	}
+	if err := parameterErrors(missing, unused); err != nil {
+		return nil, err
+	}
+	return &PreparedQuery[T]{template: template, placeholders: placeholders, fields: fields}, nil
+}
+
+// Build renders the parameters held by params into the template. The types of the
+// fields were checked by PrepareQuery, so it only fails for values rejected by
+// BuildQuery, such as an empty slice, a string holding control characters or a
+// NaN float.
+func (q *PreparedQuery[T]) Build(params T) (string, error) {
+	val, err := paramValue(reflect.ValueOf(&params).Elem())
+	if err != nil {
+		return "", err
+	}
+	query, _, _, err := substitute(q.template, q.placeholders, lookupParam(val, q.fields))
+	if err != nil {
+		return "", err
+	}
+	return query, nil
+}
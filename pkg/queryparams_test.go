@@ -0,0 +1,263 @@
+package timestream_test
+
+import (
+	"testing"
+	"time"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+const readingsTemplate = `SELECT bin(time, :bin), avg(power) FROM :db.:table WHERE site IN (:sites) AND time >= :from AND samples > :samples GROUP BY 1`
+
+type tableParams struct {
+	Database timestream.DatabaseName `param:"db"`
+	Table    timestream.TableName    `param:"table"`
+}
+
+type readingsParams struct {
+	tableParams
+	Sites   []string      `param:"sites"`
+	From    time.Time     `param:"from"`
+	Bin     time.Duration `param:"bin"`
+	Samples int           `param:"samples"`
+	Comment string
+	Ignored string `param:"-"`
+}
+
+func TestBuildQueryFrom(t *testing.T) {
+	params := readingsParams{
+		tableParams: tableParams{Database: "db", Table: "readings"},
+		Sites:       []string{"north", "O'Brien"},
+		From:        fixedNow,
+		Bin:         time.Hour,
+		Samples:     10,
+		Comment:     "not a parameter",
+	}
+	want, err := timestream.BuildQuery(readingsTemplate, map[string]interface{}{
+		"db":      timestream.DatabaseName("db"),
+		"table":   timestream.TableName("readings"),
+		"sites":   []string{"north", "O'Brien"},
+		"from":    fixedNow,
+		"bin":     time.Hour,
+		"samples": 10,
+	})
+	assert.NoError(t, err)
+
+	t.Run("renders fields like BuildQuery", func(t *testing.T) {
+		got, err := timestream.BuildQueryFrom(readingsTemplate, params)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		got, err = timestream.BuildQueryFrom(readingsTemplate, &params)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("renders QueryParamFormatter fields", func(t *testing.T) {
+		got, err := timestream.BuildQueryFrom(`SELECT * FROM t WHERE time >= :from`, struct {
+			From timestream.QueryParamFormatter `param:"from"`
+		}{timestream.TimeIn(fixedNow, "ms")})
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT * FROM t WHERE time >= from_milliseconds(1704067200000)`, got)
+	})
+
+	t.Run("PreparedQuery renders the same query", func(t *testing.T) {
+		prepared, err := timestream.PrepareQuery[readingsParams](readingsTemplate)
+		assert.NoError(t, err)
+		got, err := prepared.Build(params)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		pointers, err := timestream.PrepareQuery[*readingsParams](readingsTemplate)
+		assert.NoError(t, err)
+		got, err = pointers.Build(&params)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+		_, err = pointers.Build(nil)
+		assert.EqualError(t, err, "params is nil")
+	})
+
+	t.Run("PreparedQuery reports values that cannot be rendered", func(t *testing.T) {
+		prepared, err := timestream.PrepareQuery[readingsParams](readingsTemplate)
+		assert.NoError(t, err)
+		empty := params
+		empty.Sites = nil
+		_, err = prepared.Build(empty)
+		assert.EqualError(t, err, "parameter sites is an empty slice, which cannot form an IN list")
+	})
+}
+
+func TestBuildQueryFromErrors(t *testing.T) {
+	type Unexported struct {
+		site string `param:"site"`
+	}
+	type BadName struct {
+		Site string `param:"site-id"`
+	}
+	type Duplicate struct {
+		Site  string `param:"site"`
+		Other string `param:"site"`
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		params   any
+		wantErr  string
+	}{
+		{
+			name:     "missing fields",
+			template: `SELECT * FROM t WHERE site = :site AND device = :device`,
+			params: struct {
+				Site string `param:"site"`
+			}{"north"},
+			wantErr: "missing parameters for placeholders: :device",
+		},
+		{
+			name:     "unused fields",
+			template: `SELECT * FROM t`,
+			params: struct {
+				Site string `param:"site"`
+			}{"north"},
+			wantErr: "parameters not found in query template: site",
+		},
+		{
+			name:     "not a struct",
+			template: `SELECT * FROM t`,
+			params:   map[string]interface{}{},
+			wantErr:  "params must be a struct, got map[string]interface {}",
+		},
+		{
+			name:     "nil params",
+			template: `SELECT * FROM t`,
+			params:   nil,
+			wantErr:  "params must be a struct, got <nil>",
+		},
+		{
+			name:     "nil pointer",
+			template: `SELECT * FROM t`,
+			params:   (*readingsParams)(nil),
+			wantErr:  "params is nil",
+		},
+		{
+			name:     "unexported field",
+			template: `SELECT * FROM t WHERE site = :site`,
+			params:   Unexported{},
+			wantErr:  `invalid tag "site" on field site of timestream_test.Unexported: field is not accessible, needs to be public`,
+		},
+		{
+			name:     "invalid name",
+			template: `SELECT * FROM t WHERE site = :site`,
+			params:   BadName{},
+			wantErr:  `invalid tag "site-id" on field Site of timestream_test.BadName: parameter name must be a placeholder name`,
+		},
+		{
+			name:     "duplicate name",
+			template: `SELECT * FROM t WHERE site = :site`,
+			params:   Duplicate{},
+			wantErr:  `invalid tag "site" on field Other of timestream_test.Duplicate: duplicate parameter site`,
+		},
+		{
+			name:     "unsupported type",
+			template: `SELECT * FROM t WHERE enabled = :enabled`,
+			params: struct {
+				Enabled bool `param:"enabled"`
+			}{true},
+			wantErr: `invalid tag "enabled" on field Enabled of anonymous struct: unsupported type bool for a query parameter`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := timestream.BuildQueryFrom(tt.template, tt.params)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestPrepareQueryErrors(t *testing.T) {
+	_, err := timestream.PrepareQuery[readingsParams](`SELECT * FROM :db.:table WHERE site IN (:sites) AND device = :device AND device <> :device`)
+	assert.ErrorIs(t, err, timestream.ErrMissingParameter)
+	assert.ErrorIs(t, err, timestream.ErrUnusedParameter)
+	assert.EqualError(t, err, "missing parameters for placeholders: :device\nparameters not found in query template: bin, from, samples")
+
+	_, err = timestream.PrepareQuery[string](`SELECT 1`)
+	assert.EqualError(t, err, "params must be a struct, got string")
+
+	_, err = timestream.PrepareQuery[readingsParams](`SELECT ':unterminated`)
+	assert.Error(t, err)
+}
+
+func TestPrepareQueryChecksFieldTypes(t *testing.T) {
+	type Site string
+	type Uint struct {
+		X uint32 `param:"x"`
+	}
+	type Float32 struct {
+		X float32 `param:"x"`
+	}
+	type NamedString struct {
+		X Site `param:"x"`
+	}
+	type Bytes struct {
+		X []byte `param:"x"`
+	}
+	type Bools struct {
+		X []bool `param:"x"`
+	}
+	type Pointer struct {
+		X *string `param:"x"`
+	}
+
+	tests := []struct {
+		name    string
+		prepare func() error
+		wantErr string
+	}{
+		{
+			name:    "unsigned integer",
+			prepare: func() error { _, err := timestream.PrepareQuery[Uint](`SELECT :x`); return err },
+			wantErr: `invalid tag "x" on field X of timestream_test.Uint: unsupported type uint32 for a query parameter`,
+		},
+		{
+			name:    "float32",
+			prepare: func() error { _, err := timestream.PrepareQuery[Float32](`SELECT :x`); return err },
+			wantErr: `invalid tag "x" on field X of timestream_test.Float32: unsupported type float32 for a query parameter`,
+		},
+		{
+			name:    "named string",
+			prepare: func() error { _, err := timestream.PrepareQuery[NamedString](`SELECT :x`); return err },
+			wantErr: `invalid tag "x" on field X of timestream_test.NamedString: unsupported type timestream_test.Site for a query parameter`,
+		},
+		{
+			name:    "byte slice",
+			prepare: func() error { _, err := timestream.PrepareQuery[Bytes](`SELECT :x`); return err },
+			wantErr: `invalid tag "x" on field X of timestream_test.Bytes: unsupported type []uint8 for a query parameter, use a string`,
+		},
+		{
+			name:    "slice of unsupported elements",
+			prepare: func() error { _, err := timestream.PrepareQuery[Bools](`SELECT :x`); return err },
+			wantErr: `invalid tag "x" on field X of timestream_test.Bools: unsupported type []bool for a query parameter`,
+		},
+		{
+			name:    "pointer",
+			prepare: func() error { _, err := timestream.PrepareQuery[Pointer](`SELECT :x`); return err },
+			wantErr: `invalid tag "x" on field X of timestream_test.Pointer: unsupported type *string for a query parameter`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.prepare()
+			var tagErr *timestream.TagError
+			assert.ErrorAs(t, err, &tagErr)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	_, err := timestream.PrepareQuery[struct {
+		Sites []timestream.TableName           `param:"sites"`
+		From  timestream.QueryParamFormatter   `param:"from"`
+		Bins  []timestream.QueryParamFormatter `param:"bins"`
+	}](`SELECT :sites, :from, :bins`)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,163 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+)
+
+// RetryPolicy controls how Writer retries throttled requests, server errors and
+// rejected records the RejectionPolicy chose to retry. Delays grow exponentially
+// from BaseDelay up to MaxDelay, and a random jitter is applied to each of them.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made for a batch, including the first one.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by a Writer unless WithRetryPolicy is given.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// backoff returns the delay to wait before the given retry, starting at 1, using
+// full jitter.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.MaxDelay
+	// Compare before shifting, as shifting a large BaseDelay overflows.
+	if shift := retry - 1; shift < 32 && p.BaseDelay <= p.MaxDelay>>shift {
+		delay = p.BaseDelay << shift
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+func (p RetryPolicy) wait(ctx context.Context, retry int) error {
+	timer := time.NewTimer(p.backoff(retry))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Rejection describes a record Timestream rejected in a WriteRecords request.
+type Rejection struct {
+	// Value is the Go value the record was marshalled from, or the record itself
+	// when records were written directly.
+	Value  any
+	Record types.Record
+	Reason string
+	// ExistingVersion is set when a record with the same dimensions, time and measure
+	// name but a higher or equal version already exists.
+	ExistingVersion *int64
+}
+
+// IsVersionConflict reports whether the record was rejected because a record with a
+// higher or equal version already exists.
+func (r Rejection) IsVersionConflict() bool {
+	return r.ExistingVersion != nil
+}
+
+// RejectionAction tells Writer what to do with a rejected record.
+type RejectionAction int
+
+const (
+	// RejectionFail reports the rejection in the error returned by the write.
+	RejectionFail RejectionAction = iota
+	// RejectionRetry sends the record again, following the RetryPolicy.
+	RejectionRetry
+	// RejectionDrop discards the record silently.
+	RejectionDrop
+	// RejectionDeadLetter hands the record to the dead letter handler.
+	RejectionDeadLetter
+)
+
+// RejectionPolicy chooses the action to take for a rejected record.
+type RejectionPolicy func(Rejection) RejectionAction
+
+// DeadLetterHandler receives the records a RejectionPolicy sent to the dead letter.
+type DeadLetterHandler func(ctx context.Context, rejections []Rejection)
+
+// RejectedRecordsError is returned by Writer when Timestream rejected records that
+// were neither dropped nor dead-lettered, or that were still rejected after the last
+// retry. The other records of the request were written.
+type RejectedRecordsError struct {
+	Table      string
+	Rejections []Rejection
+}
+
+func (e *RejectedRecordsError) Error() string {
+	reasons := make([]string, 0, len(e.Rejections))
+	for _, r := range e.Rejections {
+		reasons = append(reasons, r.Reason)
+	}
+	return fmt.Sprintf("%d records rejected by %s: %s", len(e.Rejections), e.Table, strings.Join(reasons, "; "))
+}
+
+// VersionConflictError is returned by Writer when records were rejected because
+// records with a higher or equal version already exist. Resending them with a
+// version greater than ExistingVersions forces the update.
+type VersionConflictError struct {
+	Table      string
+	Rejections []Rejection
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%d records rejected by %s due to version conflicts, existing versions %v",
+		len(e.Rejections), e.Table, e.ExistingVersions())
+}
+
+// ExistingVersions returns the existing version of each conflicting record, in the
+// order of Rejections.
+func (e *VersionConflictError) ExistingVersions() []int64 {
+	versions := make([]int64, 0, len(e.Rejections))
+	for _, r := range e.Rejections {
+		versions = append(versions, *r.ExistingVersion)
+	}
+	return versions
+}
+
+// rejectionsError builds the error reporting rejections that failed, splitting out
+// version conflicts.
+func rejectionsError(table string, rejections []Rejection) error {
+	var conflicts, others []Rejection
+	for _, r := range rejections {
+		if r.IsVersionConflict() {
+			conflicts = append(conflicts, r)
+		} else {
+			others = append(others, r)
+		}
+	}
+
+	var errs error
+	if len(conflicts) > 0 {
+		errs = errors.Join(errs, &VersionConflictError{Table: table, Rejections: conflicts})
+	}
+	if len(others) > 0 {
+		errs = errors.Join(errs, &RejectedRecordsError{Table: table, Rejections: others})
+	}
+	return errs
+}
+
+// isRetryable reports whether err is a throttling or server side error, after which
+// the whole request can be sent again.
+func isRetryable(err error) bool {
+	var throttling *types.ThrottlingException
+	var internal *types.InternalServerException
+	if errors.As(err, &throttling) || errors.As(err, &internal) {
+		return true
+	}
+
+	var statusErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &statusErr) && statusErr.HTTPStatusCode() >= 500
+}
@@ -0,0 +1,254 @@
+package timestream
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+)
+
+var (
+	mapType      = reflect.TypeOf(map[string]any(nil))
+	scalarGoType = map[types.ScalarType]reflect.Type{
+		types.ScalarTypeVarchar:             reflect.TypeOf(""),
+		types.ScalarTypeBigint:              reflect.TypeOf(int64(0)),
+		types.ScalarTypeInteger:             reflect.TypeOf(int64(0)),
+		types.ScalarTypeDouble:              reflect.TypeOf(float64(0)),
+		types.ScalarTypeBoolean:             reflect.TypeOf(false),
+		types.ScalarTypeTimestamp:           timeType,
+		types.ScalarTypeDate:                timeType,
+		types.ScalarTypeTime:                durationType,
+		types.ScalarTypeIntervalDayToSecond: durationType,
+		types.ScalarTypeIntervalYearToMonth: reflect.TypeOf(int64(0)),
+	}
+)
+
+// decodeAny decodes a value without a target type, choosing the Go type from the
+// column type:
+//   - VARCHAR as string
+//   - BIGINT and INTEGER as int64, and INTERVAL_YEAR_TO_MONTH as int64 months
+//   - DOUBLE as float64 and BOOLEAN as bool
+//   - TIMESTAMP and DATE as time.Time
+//   - TIME and INTERVAL_DAY_TO_SECOND as time.Duration
+//   - ARRAY as []any, ROW as map[string]any and TIMESERIES as []TimeSeriesPoint[any]
+//   - NULL as nil, and values of unknown type as string
+func decodeAny(column types.ColumnInfo, datum types.Datum) (any, error) {
+	if aws.ToBool(datum.NullValue) {
+		return nil, nil
+	}
+
+	switch {
+	case datum.ScalarValue != nil:
+		t, ok := scalarGoType[scalarTypeOf(column)]
+		if !ok {
+			return *datum.ScalarValue, nil
+		}
+
+		v := reflect.New(t).Elem()
+		if err := decodeScalar(v, scalarTypeOf(column), *datum.ScalarValue); err != nil {
+			return nil, err
+		}
+		return v.Interface(), nil
+	case datum.ArrayValue != nil:
+		elemColumn := nestedColumn(column, func(t *types.Type) *types.ColumnInfo { return t.ArrayColumnInfo })
+		values := make([]any, len(datum.ArrayValue))
+		for i, d := range datum.ArrayValue {
+			var err error
+			if values[i], err = decodeAny(elemColumn, d); err != nil {
+				return nil, fmt.Errorf("array element %d: %w", i, err)
+			}
+		}
+		return values, nil
+	case datum.RowValue != nil:
+		var columns []types.ColumnInfo
+		if column.Type != nil {
+			columns = column.Type.RowColumnInfo
+		}
+		return decodeMap(*datum.RowValue, columns)
+	case datum.TimeSeriesValue != nil:
+		valueColumn := nestedColumn(column, func(t *types.Type) *types.ColumnInfo { return t.TimeSeriesMeasureValueColumnInfo })
+		points := make([]TimeSeriesPoint[any], len(datum.TimeSeriesValue))
+		for i, p := range datum.TimeSeriesValue {
+			if err := decodeScalar(reflect.ValueOf(&points[i].Time).Elem(), types.ScalarTypeTimestamp, aws.ToString(p.Time)); err != nil {
+				return nil, fmt.Errorf("time series point %d: %w", i, err)
+			}
+			if p.Value == nil {
+				continue
+			}
+
+			var err error
+			if points[i].Value, err = decodeAny(valueColumn, *p.Value); err != nil {
+				return nil, fmt.Errorf("time series point %d: %w", i, err)
+			}
+		}
+		return points, nil
+	}
+	return nil, nil
+}
+
+// decodeMap decodes a row into a map keyed by column name.
+func decodeMap(row types.Row, columns []types.ColumnInfo) (map[string]any, error) {
+	if len(row.Data) != len(columns) {
+		return nil, fmt.Errorf("mismatched length of row data and column info")
+	}
+
+	m := make(map[string]any, len(columns))
+	for i, column := range columns {
+		v, err := decodeAny(column, row.Data[i])
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %w", aws.ToString(column.Name), err)
+		}
+		m[aws.ToString(column.Name)] = v
+	}
+	return m, nil
+}
+
+// Rows holds the decoded values of a query output along with its column metadata,
+// for results that are not known ahead of time. Values are typed as described by
+// Unmarshal for maps.
+//
+// Example usage:
+//
+//	rows, err := NewRows(queryOutput)
+//	if err != nil {
+//	    // handle error
+//	}
+//	for i := 0; i < rows.Len(); i++ {
+//	    power, err := rows.GetFloat(i, "power")
+//	    // ...
+//	}
+type Rows struct {
+	// Columns describes the columns of every row, in order.
+	Columns []types.ColumnInfo
+
+	values []map[string]any
+	lookup map[string]int
+}
+
+// NewRows decodes every row of the query output.
+func NewRows(queryOutput *timestreamquery.QueryOutput) (*Rows, error) {
+	if queryOutput == nil {
+		return nil, fmt.Errorf("queryOutput is nil")
+	}
+
+	rows := &Rows{
+		Columns: queryOutput.ColumnInfo,
+		values:  make([]map[string]any, len(queryOutput.Rows)),
+		lookup:  buildLookupTable(queryOutput.ColumnInfo),
+	}
+	for i, row := range queryOutput.Rows {
+		var err error
+		if rows.values[i], err = decodeMap(row, queryOutput.ColumnInfo); err != nil {
+			return nil, &RowError{Index: i, Err: err}
+		}
+	}
+	return rows, nil
+}
+
+// Len returns the number of rows.
+func (r *Rows) Len() int {
+	return len(r.values)
+}
+
+// ColumnNames returns the names of the columns, in order.
+func (r *Rows) ColumnNames() []string {
+	names := make([]string, len(r.Columns))
+	for i, column := range r.Columns {
+		names[i] = aws.ToString(column.Name)
+	}
+	return names
+}
+
+// ColumnType returns the scalar type of the named column, which is empty for
+// ARRAY, ROW and TIMESERIES columns.
+func (r *Rows) ColumnType(column string) (types.ScalarType, error) {
+	pos, ok := r.lookup[column]
+	if !ok {
+		return "", fmt.Errorf("column '%s' not found in Timestream data", column)
+	}
+	return scalarTypeOf(r.Columns[pos]), nil
+}
+
+// Map returns the values of a row keyed by column name.
+func (r *Rows) Map(row int) (map[string]any, error) {
+	if row < 0 || row >= len(r.values) {
+		return nil, fmt.Errorf("row %d out of range", row)
+	}
+	return r.values[row], nil
+}
+
+// Get returns the value of a column in a row, nil for NULL.
+func (r *Rows) Get(row int, column string) (any, error) {
+	if row < 0 || row >= len(r.values) {
+		return nil, fmt.Errorf("row %d out of range", row)
+	}
+	if _, ok := r.lookup[column]; !ok {
+		return nil, fmt.Errorf("column '%s' not found in Timestream data", column)
+	}
+	return r.values[row][column], nil
+}
+
+// IsNull reports whether the value of a column in a row is NULL. Unknown rows and
+// columns are reported as NULL.
+func (r *Rows) IsNull(row int, column string) bool {
+	v, err := r.Get(row, column)
+	return err != nil || v == nil
+}
+
+// GetString returns the value of a VARCHAR column in a row.
+func (r *Rows) GetString(row int, column string) (string, error) {
+	return getAs[string](r, row, column)
+}
+
+// GetInt returns the value of a BIGINT or INTEGER column in a row.
+func (r *Rows) GetInt(row int, column string) (int64, error) {
+	return getAs[int64](r, row, column)
+}
+
+// GetFloat returns the value of a DOUBLE column in a row. BIGINT and INTEGER
+// values are converted.
+func (r *Rows) GetFloat(row int, column string) (float64, error) {
+	v, err := r.Get(row, column)
+	if err != nil {
+		return 0, err
+	}
+	if n, ok := v.(int64); ok {
+		return float64(n), nil
+	}
+	return getAs[float64](r, row, column)
+}
+
+// GetBool returns the value of a BOOLEAN column in a row.
+func (r *Rows) GetBool(row int, column string) (bool, error) {
+	return getAs[bool](r, row, column)
+}
+
+// GetTime returns the value of a TIMESTAMP or DATE column in a row.
+func (r *Rows) GetTime(row int, column string) (time.Time, error) {
+	return getAs[time.Time](r, row, column)
+}
+
+// GetDuration returns the value of a TIME or INTERVAL_DAY_TO_SECOND column in a row.
+func (r *Rows) GetDuration(row int, column string) (time.Duration, error) {
+	return getAs[time.Duration](r, row, column)
+}
+
+func getAs[T any](r *Rows, row int, column string) (T, error) {
+	var zero T
+	v, err := r.Get(row, column)
+	if err != nil {
+		return zero, err
+	}
+	if v == nil {
+		return zero, fmt.Errorf("column '%s' is NULL in row %d", column, row)
+	}
+
+	typed, ok := v.(T)
+	if !ok {
+		return zero, fmt.Errorf("column '%s' holds %T, not %T", column, v, zero)
+	}
+	return typed, nil
+}
@@ -0,0 +1,150 @@
+package timestream_test
+
+import (
+	"testing"
+	"time"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDynamicRecord() *timestreamquery.QueryOutput {
+	scalar := func(scalarType types.ScalarType) *types.Type {
+		return &types.Type{ScalarType: scalarType}
+	}
+	return &timestreamquery.QueryOutput{
+		ColumnInfo: []types.ColumnInfo{
+			{Name: aws.String("site"), Type: scalar(types.ScalarTypeVarchar)},
+			{Name: aws.String("time"), Type: scalar(types.ScalarTypeTimestamp)},
+			{Name: aws.String("power"), Type: scalar(types.ScalarTypeDouble)},
+			{Name: aws.String("cycles"), Type: scalar(types.ScalarTypeBigint)},
+			{Name: aws.String("charging"), Type: scalar(types.ScalarTypeBoolean)},
+			{Name: aws.String("window"), Type: scalar(types.ScalarTypeIntervalDayToSecond)},
+			{Name: aws.String("devices"), Type: &types.Type{ArrayColumnInfo: &types.ColumnInfo{Type: scalar(types.ScalarTypeBigint)}}},
+			{Name: aws.String("untyped")},
+		},
+		Rows: []types.Row{
+			{Data: []types.Datum{
+				{ScalarValue: aws.String("north")},
+				{ScalarValue: aws.String("2024-01-08 02:32:04.000000000")},
+				{ScalarValue: aws.String("1.5")},
+				{ScalarValue: aws.String("42")},
+				{ScalarValue: aws.String("true")},
+				{ScalarValue: aws.String("0 01:00:00.000000000")},
+				{ArrayValue: []types.Datum{{ScalarValue: aws.String("1")}, {ScalarValue: aws.String("2")}}},
+				{ScalarValue: aws.String("raw")},
+			}},
+			{Data: []types.Datum{
+				{ScalarValue: aws.String("south")},
+				{ScalarValue: aws.String("2024-01-08 02:33:04.000000000")},
+				{NullValue: aws.Bool(true)},
+				{ScalarValue: aws.String("7")},
+				{ScalarValue: aws.String("false")},
+				{NullValue: aws.Bool(true)},
+				{ArrayValue: []types.Datum{}},
+				{NullValue: aws.Bool(true)},
+			}},
+		},
+	}
+}
+
+func TestUnmarshalMaps(t *testing.T) {
+	var got []map[string]any
+	err := timestream.Unmarshal(newDynamicRecord(), &got)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{
+		{
+			"site":     "north",
+			"time":     time.Date(2024, 1, 8, 2, 32, 4, 0, time.UTC),
+			"power":    1.5,
+			"cycles":   int64(42),
+			"charging": true,
+			"window":   time.Hour,
+			"devices":  []any{int64(1), int64(2)},
+			"untyped":  "raw",
+		},
+		{
+			"site":     "south",
+			"time":     time.Date(2024, 1, 8, 2, 33, 4, 0, time.UTC),
+			"power":    nil,
+			"cycles":   int64(7),
+			"charging": false,
+			"window":   nil,
+			"devices":  []any{},
+			"untyped":  nil,
+		},
+	}, got)
+
+	record := newDynamicRecord()
+	record.Rows = record.Rows[:1]
+	var single map[string]any
+	err = timestream.Unmarshal(record, &single)
+	assert.NoError(t, err)
+	assert.Equal(t, "north", single["site"])
+
+	assert.Error(t, timestream.Unmarshal(newDynamicRecord(), &single), "multiple rows need a slice")
+	assert.Error(t, timestream.Unmarshal(newDynamicRecord(), &map[string]string{}))
+	assert.Error(t, timestream.Unmarshal(newDynamicRecord(), &[]int{}))
+}
+
+func TestRows(t *testing.T) {
+	rows, err := timestream.NewRows(newDynamicRecord())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rows.Len())
+	assert.Equal(t, []string{"site", "time", "power", "cycles", "charging", "window", "devices", "untyped"}, rows.ColumnNames())
+
+	columnType, err := rows.ColumnType("power")
+	assert.NoError(t, err)
+	assert.Equal(t, types.ScalarTypeDouble, columnType)
+
+	site, err := rows.GetString(0, "site")
+	assert.NoError(t, err)
+	assert.Equal(t, "north", site)
+
+	ts, err := rows.GetTime(1, "time")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 8, 2, 33, 4, 0, time.UTC), ts)
+
+	power, err := rows.GetFloat(0, "power")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, power)
+
+	cycles, err := rows.GetFloat(1, "cycles")
+	assert.NoError(t, err, "integers are read as floats")
+	assert.Equal(t, 7.0, cycles)
+
+	charging, err := rows.GetBool(0, "charging")
+	assert.NoError(t, err)
+	assert.True(t, charging)
+
+	window, err := rows.GetDuration(0, "window")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, window)
+
+	assert.True(t, rows.IsNull(1, "power"))
+	assert.False(t, rows.IsNull(0, "power"))
+	m, err := rows.Map(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), m["cycles"])
+
+	_, err = rows.GetFloat(1, "power")
+	assert.ErrorContains(t, err, "NULL")
+	_, err = rows.GetInt(0, "power")
+	assert.ErrorContains(t, err, "holds float64")
+	_, err = rows.GetString(0, "missing")
+	assert.Error(t, err)
+	_, err = rows.Get(2, "site")
+	assert.Error(t, err)
+	_, err = rows.Map(2)
+	assert.EqualError(t, err, "row 2 out of range")
+	_, err = rows.Map(-1)
+	assert.EqualError(t, err, "row -1 out of range")
+	_, err = rows.ColumnType("missing")
+	assert.Error(t, err)
+
+	_, err = timestream.NewRows(nil)
+	assert.Error(t, err)
+}
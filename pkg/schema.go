@@ -69,7 +69,7 @@ func invertSchema[T1, T2 comparable](schema Schema[T1, T2]) invertedSchema[T2] {
 func (s TSSchema[T1, T2]) GetMeasureNameFor(metricName T2) (string, error) {
 	v, ok := s.invertedSchema[metricName]
 	if !ok {
-		return v.measureName, fmt.Errorf("metric name %T not found", metricName)
+		return v.measureName, fmt.Errorf("metric name %v not found", metricName)
 	}
 	return v.measureName, nil
 }
@@ -79,7 +79,7 @@ func (s TSSchema[T1, T2]) GetMeasureNameFor(metricName T2) (string, error) {
 func (s TSSchema[T1, T2]) GetTableNameFor(metricName T2) (string, error) {
 	v, ok := s.invertedSchema[metricName]
 	if !ok {
-		return v.tableName, fmt.Errorf("metric name %T not found", metricName)
+		return v.tableName, fmt.Errorf("metric name %v not found", metricName)
 	}
 	return v.tableName, nil
 }
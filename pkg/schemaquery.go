@@ -0,0 +1,310 @@
+package timestream
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrMultipleTables is returned by SchemaQuery.Build when the selected metrics are
+// stored in more than one table, which a single Timestream query cannot read.
+var ErrMultipleTables = errors.New("metrics are stored in several tables")
+
+// Aggregation is an aggregate function applied by a SchemaQuery to every metric
+// it selects.
+type Aggregation string
+
+const (
+	Avg   Aggregation = "avg"
+	Sum   Aggregation = "sum"
+	Min   Aggregation = "min"
+	Max   Aggregation = "max"
+	Count Aggregation = "count"
+)
+
+// BinnedTimeColumn is the column holding the start of each time bin in the
+// results of a SchemaQuery using Bin.
+const BinnedTimeColumn = "binned_time"
+
+// SchemaQuery builds Timestream SELECT statements for metrics of a TSSchema,
+// reading each metric from the table and measure the schema stores it in.
+// Methods record their arguments and return the query, so that calls can be
+// chained; errors are reported by Build and BuildByTable.
+//
+// Without an aggregation, the statement selects the time, the measure_name, the
+// dimensions declared for the measures of the metrics, and the metrics
+// themselves, ordered by time. With an aggregation, it selects the start of each
+// time bin as BinnedTimeColumn when Bin is used, the GroupBy dimensions, and the
+// aggregate of each metric under the name of the metric.
+//
+// Example usage:
+//
+//	query, err := schema.Select("db", "power", "voltage").
+//	    Where("site", "north", "south").
+//	    TimeRange(from, to).
+//	    Bin(time.Hour).
+//	    GroupBy("site").
+//	    Aggregate(timestream.Avg).
+//	    Build()
+type SchemaQuery[T1 comparable, T2 comparable] struct {
+	schema      TSSchema[T1, T2]
+	database    string
+	metrics     []T2
+	filters     []dimensionFilter[T1]
+	groupBy     []T1
+	from, to    time.Time
+	bin         time.Duration
+	aggregation Aggregation
+}
+
+type dimensionFilter[T1 comparable] struct {
+	dimension T1
+	values    []string
+}
+
+// tableQuery holds what a SchemaQuery reads from a single table.
+type tableQuery[T1 comparable, T2 comparable] struct {
+	table      string
+	measures   []string
+	metrics    []T2
+	dimensions []T1
+}
+
+// Select starts a query for the given metrics, stored in the given database.
+func (s TSSchema[T1, T2]) Select(database string, metrics ...T2) *SchemaQuery[T1, T2] {
+	return &SchemaQuery[T1, T2]{schema: s, database: database, metrics: metrics}
+}
+
+// Where restricts the query to rows whose dimension holds one of the values. The
+// dimension must be declared for the measures of the selected metrics.
+func (q *SchemaQuery[T1, T2]) Where(dimension T1, values ...string) *SchemaQuery[T1, T2] {
+	q.filters = append(q.filters, dimensionFilter[T1]{dimension: dimension, values: values})
+	return q
+}
+
+// TimeRange restricts the query to rows from, inclusive, up to to, exclusive, so
+// that consecutive ranges neither overlap nor leave gaps. A zero from or to leaves
+// that end of the range open.
+func (q *SchemaQuery[T1, T2]) TimeRange(from, to time.Time) *SchemaQuery[T1, T2] {
+	q.from, q.to = from, to
+	return q
+}
+
+// Bin groups rows into time bins of the given width, see the bin function of
+// Timestream. It requires an aggregation.
+func (q *SchemaQuery[T1, T2]) Bin(width time.Duration) *SchemaQuery[T1, T2] {
+	q.bin = width
+	return q
+}
+
+// GroupBy aggregates the rows of each combination of values of the dimensions
+// separately. It requires an aggregation.
+func (q *SchemaQuery[T1, T2]) GroupBy(dimensions ...T1) *SchemaQuery[T1, T2] {
+	q.groupBy = append(q.groupBy, dimensions...)
+	return q
+}
+
+// Aggregate applies fn to every selected metric.
+func (q *SchemaQuery[T1, T2]) Aggregate(fn Aggregation) *SchemaQuery[T1, T2] {
+	q.aggregation = fn
+	return q
+}
+
+// Build returns the SELECT statement of the query. It fails with
+// ErrMultipleTables when the metrics are stored in several tables, use
+// BuildByTable to query each of them.
+func (q *SchemaQuery[T1, T2]) Build() (string, error) {
+	tables, err := q.resolve()
+	if err != nil {
+		return "", err
+	}
+	if len(tables) > 1 {
+		names := make([]string, len(tables))
+		for i, t := range tables {
+			names[i] = t.table
+		}
+		return "", fmt.Errorf("%w: %s", ErrMultipleTables, strings.Join(names, ", "))
+	}
+	return q.build(tables[0])
+}
+
+// BuildByTable returns a SELECT statement for each table the metrics are stored
+// in, keyed by table name. The filters, time range and aggregation apply to every
+// statement, so each table must declare the dimensions they use.
+func (q *SchemaQuery[T1, T2]) BuildByTable() (map[string]string, error) {
+	tables, err := q.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	queries := make(map[string]string, len(tables))
+	for _, t := range tables {
+		query, err := q.build(t)
+		if err != nil {
+			return nil, err
+		}
+		queries[t.table] = query
+	}
+	return queries, nil
+}
+
+// resolve groups the metrics by the table they are stored in, sorted by table
+// name, and checks the parts of the query that do not depend on the table.
+func (q *SchemaQuery[T1, T2]) resolve() ([]*tableQuery[T1, T2], error) {
+	if len(q.metrics) == 0 {
+		return nil, fmt.Errorf("no metrics selected")
+	}
+	switch q.aggregation {
+	case "", Avg, Sum, Min, Max, Count:
+	default:
+		return nil, fmt.Errorf("unsupported aggregation: %s", q.aggregation)
+	}
+	if q.aggregation == "" && (q.bin != 0 || len(q.groupBy) > 0) {
+		return nil, fmt.Errorf("bin and group by require an aggregation")
+	}
+	if q.bin < 0 {
+		return nil, fmt.Errorf("invalid bin width: %s", q.bin)
+	}
+	if !q.from.IsZero() && !q.to.IsZero() && !q.from.Before(q.to) {
+		return nil, fmt.Errorf("invalid time range: %s is not before %s", q.from, q.to)
+	}
+
+	var tables []*tableQuery[T1, T2]
+	byName := make(map[string]*tableQuery[T1, T2])
+	for _, metric := range q.metrics {
+		table, err := q.schema.GetTableNameFor(metric)
+		if err != nil {
+			return nil, err
+		}
+		measure, err := q.schema.GetMeasureNameFor(metric)
+		if err != nil {
+			return nil, err
+		}
+
+		t, ok := byName[table]
+		if !ok {
+			t = &tableQuery[T1, T2]{table: table}
+			byName[table] = t
+			tables = append(tables, t)
+		}
+		if slices.Contains(t.metrics, metric) {
+			continue
+		}
+		t.metrics = append(t.metrics, metric)
+		if !slices.Contains(t.measures, measure) {
+			t.measures = append(t.measures, measure)
+			for _, dimension := range q.schema.Schema[Table(table)][MeasureName(measure)].Dimensions {
+				if !slices.Contains(t.dimensions, dimension) {
+					t.dimensions = append(t.dimensions, dimension)
+				}
+			}
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].table < tables[j].table })
+	return tables, nil
+}
+
+// build renders the statement reading t.
+func (q *SchemaQuery[T1, T2]) build(t *tableQuery[T1, T2]) (string, error) {
+	dimension := func(d T1) (string, error) {
+		if !slices.Contains(t.dimensions, d) {
+			return "", fmt.Errorf("dimension %v is not declared for the metrics of table %s", d, t.table)
+		}
+		return quoteIdentifier(fmt.Sprintf("%v", d))
+	}
+
+	database, err := quoteIdentifier(q.database)
+	if err != nil {
+		return "", fmt.Errorf("invalid database name: %w", err)
+	}
+	table, err := quoteIdentifier(t.table)
+	if err != nil {
+		return "", fmt.Errorf("invalid table name: %w", err)
+	}
+
+	var columns, groupBy, orderBy []string
+	if q.aggregation == "" {
+		columns = append(columns, "time", "measure_name")
+		for _, d := range t.dimensions {
+			column, err := dimension(d)
+			if err != nil {
+				return "", err
+			}
+			columns = append(columns, column)
+		}
+		orderBy = append(orderBy, "time")
+	} else {
+		if q.bin > 0 {
+			bin := fmt.Sprintf("bin(time, %s)", formatDuration(q.bin))
+			columns = append(columns, bin+" AS "+BinnedTimeColumn)
+			groupBy = append(groupBy, bin)
+			orderBy = append(orderBy, BinnedTimeColumn)
+		}
+		for _, d := range q.groupBy {
+			column, err := dimension(d)
+			if err != nil {
+				return "", err
+			}
+			columns = append(columns, column)
+			groupBy = append(groupBy, column)
+			orderBy = append(orderBy, column)
+		}
+	}
+	for _, metric := range t.metrics {
+		column, err := quoteIdentifier(fmt.Sprintf("%v", metric))
+		if err != nil {
+			return "", fmt.Errorf("invalid metric name: %w", err)
+		}
+		if q.aggregation != "" {
+			column = fmt.Sprintf("%s(%s) AS %s", q.aggregation, column, column)
+		}
+		columns = append(columns, column)
+	}
+
+	measures := make([]string, len(t.measures))
+	for i, measure := range t.measures {
+		if measures[i], err = quoteString(measure); err != nil {
+			return "", fmt.Errorf("invalid measure name: %w", err)
+		}
+	}
+	conditions := []string{"measure_name IN (" + strings.Join(measures, ", ") + ")"}
+	for _, f := range q.filters {
+		column, err := dimension(f.dimension)
+		if err != nil {
+			return "", err
+		}
+		if len(f.values) == 0 {
+			return "", fmt.Errorf("no values given for dimension %v", f.dimension)
+		}
+		values := make([]string, len(f.values))
+		for i, value := range f.values {
+			if values[i], err = quoteString(value); err != nil {
+				return "", fmt.Errorf("invalid value for dimension %v: %w", f.dimension, err)
+			}
+		}
+		if len(values) == 1 {
+			conditions = append(conditions, column+" = "+values[0])
+		} else {
+			conditions = append(conditions, column+" IN ("+strings.Join(values, ", ")+")")
+		}
+	}
+	if !q.from.IsZero() {
+		conditions = append(conditions, "time >= "+formatTimestamp(q.from))
+	}
+	if !q.to.IsZero() {
+		conditions = append(conditions, "time < "+formatTimestamp(q.to))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SELECT %s FROM %s.%s WHERE %s", strings.Join(columns, ", "), database, table, strings.Join(conditions, " AND "))
+	if len(groupBy) > 0 {
+		sb.WriteString(" GROUP BY " + strings.Join(groupBy, ", "))
+	}
+	if len(orderBy) > 0 {
+		sb.WriteString(" ORDER BY " + strings.Join(orderBy, ", "))
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,215 @@
+package timestream_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/EvergenEnergy/TimeSchema/pkg/timestreamtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	"github.com/stretchr/testify/assert"
+)
+
+var querySchema = timestream.NewTSSchema(timestream.Schema[testDimension, testMetricName]{
+	"readings": {
+		"battery": {Dimensions: []testDimension{"site", "device"}, MetricNames: []testMetricName{"power", "soc"}},
+		"grid":    {Dimensions: []testDimension{"site"}, MetricNames: []testMetricName{"import"}},
+	},
+	"weather": {
+		"conditions": {Dimensions: []testDimension{"site"}, MetricNames: []testMetricName{"temperature"}},
+	},
+})
+
+func TestSchemaQueryBuild(t *testing.T) {
+	to := fixedNow.Add(24 * time.Hour)
+
+	tests := []struct {
+		name  string
+		query *timestream.SchemaQuery[testDimension, testMetricName]
+		want  string
+	}{
+		{
+			name:  "selects raw metrics with their dimensions",
+			query: querySchema.Select("db", "power", "soc"),
+			want:  `SELECT time, measure_name, "site", "device", "power", "soc" FROM "db"."readings" WHERE measure_name IN ('battery') ORDER BY time`,
+		},
+		{
+			name:  "reads every measure of the metrics",
+			query: querySchema.Select("db", "import", "power", "import"),
+			want:  `SELECT time, measure_name, "site", "device", "import", "power" FROM "db"."readings" WHERE measure_name IN ('grid', 'battery') ORDER BY time`,
+		},
+		{
+			name:  "filters dimensions and time",
+			query: querySchema.Select("db", "power").Where("site", "north").Where("device", "a", "b").TimeRange(fixedNow, to),
+			want: `SELECT time, measure_name, "site", "device", "power" FROM "db"."readings" WHERE measure_name IN ('battery') AND "site" = 'north' AND "device" IN ('a', 'b')` +
+				` AND time >= TIMESTAMP '2024-01-01 00:00:00.000000000' AND time < TIMESTAMP '2024-01-02 00:00:00.000000000' ORDER BY time`,
+		},
+		{
+			name:  "leaves open ends of the time range",
+			query: querySchema.Select("db", "power").TimeRange(time.Time{}, to),
+			want:  `SELECT time, measure_name, "site", "device", "power" FROM "db"."readings" WHERE measure_name IN ('battery') AND time < TIMESTAMP '2024-01-02 00:00:00.000000000' ORDER BY time`,
+		},
+		{
+			name:  "aggregates into bins",
+			query: querySchema.Select("db", "power", "soc").Bin(15 * time.Minute).GroupBy("site").Aggregate(timestream.Avg),
+			want: `SELECT bin(time, 15m) AS binned_time, "site", avg("power") AS "power", avg("soc") AS "soc" FROM "db"."readings" WHERE measure_name IN ('battery')` +
+				` GROUP BY bin(time, 15m), "site" ORDER BY binned_time, "site"`,
+		},
+		{
+			name:  "aggregates the whole range",
+			query: querySchema.Select("db", "power").Aggregate(timestream.Max),
+			want:  `SELECT max("power") AS "power" FROM "db"."readings" WHERE measure_name IN ('battery')`,
+		},
+		{
+			name: "escapes names and values",
+			query: timestream.NewTSSchema(timestream.Schema[testDimension, testMetricName]{
+				`my"table`: {"it's": {Dimensions: []testDimension{"site"}, MetricNames: []testMetricName{"power"}}},
+			}).Select("db", "power").Where("site", "O'Brien"),
+			want: `SELECT time, measure_name, "site", "power" FROM "db"."my""table" WHERE measure_name IN ('it''s') AND "site" = 'O''Brien' ORDER BY time`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.Build()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSchemaQueryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   *timestream.SchemaQuery[testDimension, testMetricName]
+		wantErr string
+	}{
+		{
+			name:    "no metrics",
+			query:   querySchema.Select("db"),
+			wantErr: "no metrics selected",
+		},
+		{
+			name:    "unknown metric",
+			query:   querySchema.Select("db", "power", "frequency"),
+			wantErr: "metric name frequency not found",
+		},
+		{
+			name:    "undeclared dimension",
+			query:   querySchema.Select("db", "import").Where("device", "a"),
+			wantErr: "dimension device is not declared for the metrics of table readings",
+		},
+		{
+			name:    "filter without values",
+			query:   querySchema.Select("db", "power").Where("site"),
+			wantErr: "no values given for dimension site",
+		},
+		{
+			name:    "bin without aggregation",
+			query:   querySchema.Select("db", "power").Bin(time.Hour),
+			wantErr: "bin and group by require an aggregation",
+		},
+		{
+			name:    "unknown aggregation",
+			query:   querySchema.Select("db", "power").Aggregate("median"),
+			wantErr: "unsupported aggregation: median",
+		},
+		{
+			name:    "empty time range",
+			query:   querySchema.Select("db", "power").TimeRange(fixedNow, fixedNow),
+			wantErr: "invalid time range: 2024-01-01 00:00:00 +0000 UTC is not before 2024-01-01 00:00:00 +0000 UTC",
+		},
+		{
+			name:    "unsafe values",
+			query:   querySchema.Select("db", "power").Where("site", "north\n"),
+			wantErr: "invalid value for dimension site: control character U+000A at offset 5",
+		},
+		{
+			name:    "several tables",
+			query:   querySchema.Select("db", "temperature", "power"),
+			wantErr: "metrics are stored in several tables: readings, weather",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.query.Build()
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	_, err := querySchema.Select("db", "temperature", "power").Build()
+	assert.True(t, errors.Is(err, timestream.ErrMultipleTables))
+}
+
+func TestSchemaQueryBuildByTable(t *testing.T) {
+	queries, err := querySchema.Select("db", "temperature", "power").Where("site", "north").Bin(time.Hour).Aggregate(timestream.Avg).BuildByTable()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"readings": `SELECT bin(time, 1h) AS binned_time, avg("power") AS "power" FROM "db"."readings" WHERE measure_name IN ('battery') AND "site" = 'north' GROUP BY bin(time, 1h) ORDER BY binned_time`,
+		"weather":  `SELECT bin(time, 1h) AS binned_time, avg("temperature") AS "temperature" FROM "db"."weather" WHERE measure_name IN ('conditions') AND "site" = 'north' GROUP BY bin(time, 1h) ORDER BY binned_time`,
+	}, queries)
+
+	_, err = querySchema.Select("db", "temperature", "power").Where("device", "a").BuildByTable()
+	assert.EqualError(t, err, "dimension device is not declared for the metrics of table weather")
+}
+
+func TestSchemaQueryEmulated(t *testing.T) {
+	emulator := timestreamtest.NewEmulator()
+	ctx := context.Background()
+	setupEmulator(t, emulator)
+
+	type battery struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Site        string    `timestream:"dimension,name=site"`
+		Device      string    `timestream:"dimension,name=device"`
+		Power       float64   `timestream:"attribute,name=power"`
+	}
+	var batteries []battery
+	for i := 0; i < 8; i++ {
+		site := "north"
+		if i%4 == 3 {
+			site = "south"
+		}
+		batteries = append(batteries, battery{
+			Timestamp:   fixedNow.Add(time.Duration(i) * 30 * time.Minute),
+			MeasureName: "battery",
+			Site:        site,
+			Device:      "a",
+			Power:       float64(i),
+		})
+	}
+	records, err := timestream.Marshal(batteries)
+	assert.NoError(t, err)
+	_, err = emulator.WriteRecords(ctx, &timestreamwrite.WriteRecordsInput{
+		DatabaseName: aws.String("db"),
+		TableName:    aws.String("readings"),
+		Records:      records,
+	})
+	assert.NoError(t, err)
+
+	query, err := querySchema.Select("db", "power").
+		Where("site", "north").
+		TimeRange(fixedNow, fixedNow.Add(3*time.Hour)).
+		Bin(time.Hour).
+		GroupBy("site").
+		Aggregate(timestream.Avg).
+		Build()
+	assert.NoError(t, err)
+
+	rows, err := timestream.Query[struct {
+		Hour  time.Time `timestream:"name=binned_time"`
+		Site  string    `timestream:"name=site"`
+		Power float64   `timestream:"name=power"`
+	}](ctx, emulator, query)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, fixedNow, rows[0].Hour)
+		assert.Equal(t, 0.5, rows[0].Power)
+		assert.Equal(t, 2.0, rows[1].Power, "south is filtered out")
+		assert.Equal(t, 4.5, rows[2].Power)
+	}
+}
@@ -0,0 +1,262 @@
+package timestream
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Columns that Timestream exposes for the record timestamp and measure name.
+const (
+	timeColumn        = "time"
+	measureNameColumn = "measure_name"
+)
+
+// fieldTag is a parsed `timestream` struct tag, shared by Marshal and Unmarshal.
+//
+// A tag starts with the role of the field: "timestamp" (or "time"), "measure",
+// "dimension", "attribute" or "inline". Options follow, separated by commas:
+// "name=", "omitempty", "unit=", "precision=" and "prefix=". A tag made only of
+// options, such as `timestream:"name=avg_power"`, maps a field to a query column
+// without taking part in Marshal.
+type fieldTag struct {
+	kind      requiredField
+	name      string
+	unit      string
+	precision int
+	prefix    string
+	omitEmpty bool
+}
+
+// parseTag parses a tag, rejecting unknown roles and options.
+func parseTag(tag string) (fieldTag, error) {
+	parsed := fieldTag{precision: -1}
+	for i, part := range strings.Split(tag, ",") {
+		key, value, hasValue := strings.Cut(part, "=")
+		switch {
+		case !hasValue && i == 0 && part == "time":
+			parsed.kind = timestamp
+		case !hasValue && i == 0 && slices.Contains([]requiredField{timestamp, measure, dimension, attribute, inlineTag}, requiredField(part)):
+			parsed.kind = requiredField(part)
+		case !hasValue && part == "omitempty":
+			parsed.omitEmpty = true
+		case hasValue && key == "name" && value != "":
+			parsed.name = value
+		case hasValue && key == "unit":
+			if _, ok := timeUnits[value]; !ok {
+				return fieldTag{}, fmt.Errorf("unsupported unit %q", value)
+			}
+			parsed.unit = value
+		case hasValue && key == "precision":
+			p, err := strconv.Atoi(value)
+			if err != nil || p < 1 {
+				return fieldTag{}, fmt.Errorf("invalid precision option %q", part)
+			}
+			parsed.precision = p
+		case hasValue && key == "prefix":
+			parsed.prefix = value
+		default:
+			return fieldTag{}, fmt.Errorf("unknown option %q", part)
+		}
+	}
+	return parsed, nil
+}
+
+// fieldName returns the name of a dimension or attribute, which defaults to the
+// name of the struct field.
+func (t fieldTag) fieldName(field reflect.StructField) string {
+	if t.name != "" {
+		return t.name
+	}
+	return field.Name
+}
+
+// columnName returns the query column a field reads from: "time" for the
+// timestamp, "measure_name" for the measure, and the prefixed name for dimensions
+// and attributes. An explicit name always wins for timestamp and measure fields.
+func (t fieldTag) columnName(field reflect.StructField, prefix string) (string, error) {
+	switch t.kind {
+	case timestamp:
+		if t.name != "" {
+			return t.name, nil
+		}
+		return timeColumn, nil
+	case measure:
+		if t.name != "" {
+			return t.name, nil
+		}
+		return measureNameColumn, nil
+	case dimension, attribute:
+		return prefix + t.fieldName(field), nil
+	default:
+		if t.name == "" {
+			return "", fmt.Errorf("no role nor name")
+		}
+		return prefix + t.name, nil
+	}
+}
+
+// structWalk is the position of a walk through a struct type and the structs it
+// embeds or inlines, shared by the field collection of Marshal and Unmarshal.
+type structWalk struct {
+	root   reflect.Type
+	index  []int
+	path   string
+	prefix string
+	depth  int
+	// readOnly is set below unexported named structs, whose fields cannot be read.
+	readOnly bool
+}
+
+func newStructWalk(t reflect.Type) structWalk {
+	return structWalk{root: t}
+}
+
+// at returns the index and path of the i-th field of the current struct.
+func (w structWalk) at(i int, field reflect.StructField) ([]int, string) {
+	index := append(append([]int(nil), w.index...), i)
+	if w.path == "" {
+		return index, field.Name
+	}
+	return index, w.path + "." + field.Name
+}
+
+// nested returns the walk of the struct held by the i-th field of the current struct.
+func (w structWalk) nested(i int, field reflect.StructField, prefix string) (structWalk, error) {
+	if w.depth >= maxInlineDepth {
+		return structWalk{}, fmt.Errorf("struct nesting of %s exceeds %d levels, possibly a cycle", typeName(w.root), maxInlineDepth)
+	}
+
+	index, path := w.at(i, field)
+	return structWalk{
+		root:   w.root,
+		index:  index,
+		path:   path,
+		prefix: w.prefix + prefix,
+		depth:  w.depth + 1,
+		// The exported fields of an unexported embedded struct are promoted and
+		// remain readable, unlike those of an unexported named struct.
+		readOnly: w.readOnly || (!field.IsExported() && !field.Anonymous),
+	}, nil
+}
+
+func (w structWalk) tagError(path, tag string, err error) error {
+	return &TagError{Type: typeName(w.root), Field: path, Tag: tag, Err: err}
+}
+
+// columnField is a struct field Unmarshal decodes a column into. index leads to
+// the field through embedded and inlined structs, as for reflect.Value.FieldByIndex,
+// and path names it the same way.
+type columnField struct {
+	index  []int
+	path   string
+	field  reflect.StructField
+	column string
+}
+
+// checkModeField checks that a field tagged with a measure mode is a blank field,
+// as any other field would be left out of Marshal and Unmarshal.
+func checkModeField(w structWalk, i int, field reflect.StructField, tag string) error {
+	if field.Name == "_" {
+		return nil
+	}
+	_, path := w.at(i, field)
+	return w.tagError(path, tag, fmt.Errorf("mode can only be set on a blank _ field"))
+}
+
+func collectColumnFields(t reflect.Type, w structWalk) ([]columnField, error) {
+	var fields []columnField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("timestream")
+		ok = ok && tag != ""
+		if tag == "-" || (!ok && !field.Anonymous) {
+			continue
+		}
+		if strings.HasPrefix(tag, modeTagPrefix) {
+			if err := checkModeField(w, i, field, tag); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		index, path := w.at(i, field)
+		var parsed fieldTag
+		if ok {
+			var err error
+			if parsed, err = parseTag(tag); err != nil {
+				return nil, w.tagError(path, tag, err)
+			}
+		}
+
+		if parsed.kind == inlineTag || !ok {
+			if !isInlineable(field.Type) {
+				if ok {
+					return nil, w.tagError(path, tag, fmt.Errorf("inline can only be used with struct fields"))
+				}
+				continue
+			}
+			if !field.IsExported() && field.Type.Kind() == reflect.Pointer {
+				continue
+			}
+
+			nestedType := field.Type
+			if nestedType.Kind() == reflect.Pointer {
+				nestedType = nestedType.Elem()
+			}
+			nw, err := w.nested(i, field, parsed.prefix)
+			if err != nil {
+				return nil, err
+			}
+			nested, err := collectColumnFields(nestedType, nw)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+			continue
+		}
+
+		if !field.IsExported() {
+			return nil, w.tagError(path, tag, fmt.Errorf("field is not accessible, needs to be public"))
+		}
+
+		column, err := parsed.columnName(field, w.prefix)
+		if err != nil {
+			return nil, w.tagError(path, tag, err)
+		}
+		fields = append(fields, columnField{index: index, path: path, field: field, column: column})
+	}
+	return fields, nil
+}
+
+// fieldByIndex returns the field of v at index, allocating the nil struct
+// pointers met on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// fieldValue returns the field of v at index, or the zero Value when a nil struct
+// pointer is met on the way.
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
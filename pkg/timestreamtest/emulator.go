@@ -0,0 +1,645 @@
+package timestreamtest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	querytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+)
+
+var (
+	_ timestream.WriteAPI = (*Emulator)(nil)
+	_ timestream.QueryAPI = (*Emulator)(nil)
+)
+
+// Emulator is an in-memory stand-in for Timestream implementing both WriteAPI and
+// QueryAPI, so that data can be written and queried back in tests without AWS.
+//
+// Databases and tables must be created before records are written to them. Records
+// are stored the way Timestream exposes them to queries: one row per record, with a
+// column per dimension, a measure_name and a time column, and a column per measure
+// value for MULTI records or a measure_value::<type> column for single-measure ones.
+// Writing a record with the same dimensions, measure name and time as a stored one
+// replaces it when its version is higher, is a no-op when its values are identical,
+// and is rejected otherwise, as Timestream does.
+//
+// Queries support a subset of the Timestream SQL dialect:
+//   - SELECT with column references, aliases, arithmetic, * and the aggregates avg,
+//     sum, min, max and count
+//   - FROM "database"."table"
+//   - WHERE with comparisons, BETWEEN, IN, IS NULL, AND, OR and NOT
+//   - GROUP BY, ORDER BY and LIMIT, referencing expressions, aliases or positions
+//   - the functions bin, ago, now, from_unixtime, from_milliseconds and from_nanoseconds
+//
+// Result columns are typed from the stored measure value types, and results are
+// paginated according to QueryInput.MaxRows. Timestamp measure values are read in
+// the time unit of their record. An Emulator is safe for concurrent use.
+type Emulator struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	databases map[string]*emulatedDatabase
+	pages     map[string]emulatedPage
+	queries   int
+}
+
+// emulatedPage holds the remaining rows of a paginated query.
+type emulatedPage struct {
+	columns []querytypes.ColumnInfo
+	rows    []querytypes.Row
+}
+
+type emulatedDatabase struct {
+	createdAt time.Time
+	tables    map[string]*emulatedTable
+}
+
+type emulatedTable struct {
+	createdAt time.Time
+	columns   []emulatedColumn
+	rows      []emulatedRow
+	index     map[string]int
+}
+
+type emulatedColumn struct {
+	name      string
+	kind      columnKind
+	valueType querytypes.ScalarType
+}
+
+type columnKind int
+
+const (
+	dimensionColumn columnKind = iota
+	measureNameColumn
+	timeColumn
+	measureColumn
+)
+
+type emulatedRow struct {
+	values  map[string]any
+	version int64
+}
+
+// EmulatorOption configures an Emulator.
+type EmulatorOption func(*Emulator)
+
+// WithClock sets the clock used for now() and ago() in queries. It defaults to time.Now.
+func WithClock(now func() time.Time) EmulatorOption {
+	return func(e *Emulator) {
+		e.now = now
+	}
+}
+
+// NewEmulator returns an Emulator without any database.
+func NewEmulator(opts ...EmulatorOption) *Emulator {
+	e := &Emulator{
+		now:       time.Now,
+		databases: make(map[string]*emulatedDatabase),
+		pages:     make(map[string]emulatedPage),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func notFound(format string, args ...any) error {
+	return &types.ResourceNotFoundException{Message: aws.String(fmt.Sprintf(format, args...))}
+}
+
+func (e *Emulator) table(database, table *string) (*emulatedTable, error) {
+	db, ok := e.databases[aws.ToString(database)]
+	if !ok {
+		return nil, notFound("database %s does not exist", aws.ToString(database))
+	}
+	t, ok := db.tables[aws.ToString(table)]
+	if !ok {
+		return nil, notFound("table %s does not exist in database %s", aws.ToString(table), aws.ToString(database))
+	}
+	return t, nil
+}
+
+// CreateDatabase creates an empty database.
+func (e *Emulator) CreateDatabase(ctx context.Context, params *timestreamwrite.CreateDatabaseInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.CreateDatabaseOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := aws.ToString(params.DatabaseName)
+	if _, ok := e.databases[name]; ok {
+		return nil, &types.ConflictException{Message: aws.String(fmt.Sprintf("database %s already exists", name))}
+	}
+	db := &emulatedDatabase{createdAt: e.now(), tables: make(map[string]*emulatedTable)}
+	e.databases[name] = db
+	return &timestreamwrite.CreateDatabaseOutput{Database: db.describe(name)}, nil
+}
+
+func (db *emulatedDatabase) describe(name string) *types.Database {
+	return &types.Database{
+		DatabaseName:    aws.String(name),
+		TableCount:      int64(len(db.tables)),
+		CreationTime:    aws.Time(db.createdAt),
+		LastUpdatedTime: aws.Time(db.createdAt),
+	}
+}
+
+// DescribeDatabase describes an existing database.
+func (e *Emulator) DescribeDatabase(ctx context.Context, params *timestreamwrite.DescribeDatabaseInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.DescribeDatabaseOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := aws.ToString(params.DatabaseName)
+	db, ok := e.databases[name]
+	if !ok {
+		return nil, notFound("database %s does not exist", name)
+	}
+	return &timestreamwrite.DescribeDatabaseOutput{Database: db.describe(name)}, nil
+}
+
+// ListDatabases lists every database, sorted by name, in a single page.
+func (e *Emulator) ListDatabases(ctx context.Context, _ *timestreamwrite.ListDatabasesInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.ListDatabasesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var out timestreamwrite.ListDatabasesOutput
+	for _, name := range sortedKeys(e.databases) {
+		out.Databases = append(out.Databases, *e.databases[name].describe(name))
+	}
+	return &out, nil
+}
+
+// UpdateDatabase accepts the update of an existing database. Encryption keys are not emulated.
+func (e *Emulator) UpdateDatabase(ctx context.Context, params *timestreamwrite.UpdateDatabaseInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.UpdateDatabaseOutput, error) {
+	out, err := e.DescribeDatabase(ctx, &timestreamwrite.DescribeDatabaseInput{DatabaseName: params.DatabaseName})
+	if err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.UpdateDatabaseOutput{Database: out.Database}, nil
+}
+
+// DeleteDatabase deletes an existing database. As in Timestream, it must not hold any table.
+func (e *Emulator) DeleteDatabase(ctx context.Context, params *timestreamwrite.DeleteDatabaseInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.DeleteDatabaseOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := aws.ToString(params.DatabaseName)
+	db, ok := e.databases[name]
+	if !ok {
+		return nil, notFound("database %s does not exist", name)
+	}
+	if len(db.tables) > 0 {
+		return nil, &types.ValidationException{Message: aws.String(fmt.Sprintf("database %s still has tables", name))}
+	}
+	delete(e.databases, name)
+	return &timestreamwrite.DeleteDatabaseOutput{}, nil
+}
+
+// CreateTable creates an empty table in an existing database.
+func (e *Emulator) CreateTable(ctx context.Context, params *timestreamwrite.CreateTableInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.CreateTableOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	dbName, name := aws.ToString(params.DatabaseName), aws.ToString(params.TableName)
+	db, ok := e.databases[dbName]
+	if !ok {
+		return nil, notFound("database %s does not exist", dbName)
+	}
+	if _, ok := db.tables[name]; ok {
+		return nil, &types.ConflictException{Message: aws.String(fmt.Sprintf("table %s already exists", name))}
+	}
+	t := &emulatedTable{createdAt: e.now(), index: make(map[string]int)}
+	db.tables[name] = t
+	return &timestreamwrite.CreateTableOutput{Table: t.describe(dbName, name)}, nil
+}
+
+func (t *emulatedTable) describe(database, name string) *types.Table {
+	return &types.Table{
+		DatabaseName:    aws.String(database),
+		TableName:       aws.String(name),
+		TableStatus:     types.TableStatusActive,
+		CreationTime:    aws.Time(t.createdAt),
+		LastUpdatedTime: aws.Time(t.createdAt),
+	}
+}
+
+// DescribeTable describes an existing table.
+func (e *Emulator) DescribeTable(ctx context.Context, params *timestreamwrite.DescribeTableInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.DescribeTableOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, err := e.table(params.DatabaseName, params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.DescribeTableOutput{Table: t.describe(aws.ToString(params.DatabaseName), aws.ToString(params.TableName))}, nil
+}
+
+// ListTables lists the tables of a database, sorted by name, in a single page.
+func (e *Emulator) ListTables(ctx context.Context, params *timestreamwrite.ListTablesInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.ListTablesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := aws.ToString(params.DatabaseName)
+	db, ok := e.databases[name]
+	if !ok {
+		return nil, notFound("database %s does not exist", name)
+	}
+
+	var out timestreamwrite.ListTablesOutput
+	for _, tableName := range sortedKeys(db.tables) {
+		out.Tables = append(out.Tables, *db.tables[tableName].describe(name, tableName))
+	}
+	return &out, nil
+}
+
+// UpdateTable accepts the update of an existing table. Retention and storage settings are not emulated.
+func (e *Emulator) UpdateTable(ctx context.Context, params *timestreamwrite.UpdateTableInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.UpdateTableOutput, error) {
+	out, err := e.DescribeTable(ctx, &timestreamwrite.DescribeTableInput{DatabaseName: params.DatabaseName, TableName: params.TableName})
+	if err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.UpdateTableOutput{Table: out.Table}, nil
+}
+
+// DeleteTable deletes an existing table along with its records.
+func (e *Emulator) DeleteTable(ctx context.Context, params *timestreamwrite.DeleteTableInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.DeleteTableOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := e.table(params.DatabaseName, params.TableName); err != nil {
+		return nil, err
+	}
+	delete(e.databases[aws.ToString(params.DatabaseName)].tables, aws.ToString(params.TableName))
+	return &timestreamwrite.DeleteTableOutput{}, nil
+}
+
+// WriteRecords stores the records of the request, merged with its CommonAttributes.
+// Invalid records and version conflicts are reported in a RejectedRecordsException,
+// while the other records are stored.
+func (e *Emulator) WriteRecords(ctx context.Context, params *timestreamwrite.WriteRecordsInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.WriteRecordsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(params.Records) == 0 || len(params.Records) > 100 {
+		return nil, &types.ValidationException{Message: aws.String(fmt.Sprintf("expected 1 to 100 records, got %d", len(params.Records)))}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, err := e.table(params.DatabaseName, params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var rejected []types.RejectedRecord
+	for i, r := range params.Records {
+		if params.CommonAttributes != nil {
+			r = mergeRecord(*params.CommonAttributes, r)
+		}
+		if rejection := t.write(r); rejection != nil {
+			rejection.RecordIndex = int32(i)
+			rejected = append(rejected, *rejection)
+		}
+	}
+
+	ingested := int32(len(params.Records) - len(rejected))
+	if len(rejected) > 0 {
+		return nil, &types.RejectedRecordsException{
+			Message:         aws.String(fmt.Sprintf("%d records were rejected", len(rejected))),
+			RejectedRecords: rejected,
+		}
+	}
+	return &timestreamwrite.WriteRecordsOutput{
+		RecordsIngested: &types.RecordsIngested{MemoryStore: ingested, Total: ingested},
+	}, nil
+}
+
+// mergeRecord applies the record level attributes over the common ones. Dimensions
+// are combined.
+func mergeRecord(common, r types.Record) types.Record {
+	merged := common
+	merged.Dimensions = append(slices.Clone(common.Dimensions), r.Dimensions...)
+	if r.MeasureName != nil {
+		merged.MeasureName = r.MeasureName
+	}
+	if r.MeasureValue != nil {
+		merged.MeasureValue = r.MeasureValue
+	}
+	if r.MeasureValueType != "" {
+		merged.MeasureValueType = r.MeasureValueType
+	}
+	if r.MeasureValues != nil {
+		merged.MeasureValues = r.MeasureValues
+	}
+	if r.Time != nil {
+		merged.Time = r.Time
+	}
+	if r.TimeUnit != "" {
+		merged.TimeUnit = r.TimeUnit
+	}
+	if r.Version != nil {
+		merged.Version = r.Version
+	}
+	return merged
+}
+
+func reject(format string, args ...any) *types.RejectedRecord {
+	return &types.RejectedRecord{Reason: aws.String(fmt.Sprintf(format, args...))}
+}
+
+// write validates and stores a record, returning a rejection when it cannot be stored.
+func (t *emulatedTable) write(r types.Record) *types.RejectedRecord {
+	if r.MeasureName == nil || *r.MeasureName == "" {
+		return reject("measure name is missing")
+	}
+	if r.Time == nil {
+		return reject("time is missing")
+	}
+	ts, err := parseEpoch(*r.Time, r.TimeUnit)
+	if err != nil {
+		return reject("invalid time: %v", err)
+	}
+
+	row := emulatedRow{values: map[string]any{"measure_name": *r.MeasureName, "time": ts}, version: 1}
+	if r.Version != nil {
+		row.version = *r.Version
+	}
+
+	columns := []emulatedColumn{
+		{name: "measure_name", kind: measureNameColumn, valueType: querytypes.ScalarTypeVarchar},
+		{name: "time", kind: timeColumn, valueType: querytypes.ScalarTypeTimestamp},
+	}
+
+	dimensions := make([]string, 0, len(r.Dimensions))
+	for _, d := range r.Dimensions {
+		name := aws.ToString(d.Name)
+		if _, ok := row.values[name]; ok {
+			return reject("duplicate dimension %s", name)
+		}
+		row.values[name] = aws.ToString(d.Value)
+		columns = append(columns, emulatedColumn{name: name, kind: dimensionColumn, valueType: querytypes.ScalarTypeVarchar})
+		dimensions = append(dimensions, name+"="+aws.ToString(d.Value))
+	}
+
+	switch r.MeasureValueType {
+	case types.MeasureValueTypeMulti:
+		if len(r.MeasureValues) == 0 {
+			return reject("MULTI record without measure values")
+		}
+		for _, mv := range r.MeasureValues {
+			name := aws.ToString(mv.Name)
+			if _, ok := row.values[name]; ok {
+				return reject("measure value %s collides with another column", name)
+			}
+			v, valueType, err := parseMeasureValue(aws.ToString(mv.Value), mv.Type, r.TimeUnit)
+			if err != nil {
+				return reject("invalid measure value %s: %v", name, err)
+			}
+			row.values[name] = v
+			columns = append(columns, emulatedColumn{name: name, kind: measureColumn, valueType: valueType})
+		}
+	case "":
+		return reject("measure value type is missing")
+	default:
+		if r.MeasureValue == nil {
+			return reject("measure value is missing")
+		}
+		v, valueType, err := parseMeasureValue(*r.MeasureValue, r.MeasureValueType, r.TimeUnit)
+		if err != nil {
+			return reject("invalid measure value: %v", err)
+		}
+		name := "measure_value::" + strings.ToLower(string(valueType))
+		row.values[name] = v
+		columns = append(columns, emulatedColumn{name: name, kind: measureColumn, valueType: valueType})
+	}
+
+	for _, c := range columns {
+		for _, existing := range t.columns {
+			if existing.name == c.name && (existing.kind != c.kind || existing.valueType != c.valueType) {
+				return reject("column %s was written with another type", c.name)
+			}
+		}
+	}
+
+	sort.Strings(dimensions)
+	key := strings.Join(dimensions, "\x00") + "\x00" + *r.MeasureName + "\x00" + strconv.FormatInt(ts.UnixNano(), 10)
+	if i, ok := t.index[key]; ok {
+		existing := t.rows[i]
+		if row.version <= existing.version {
+			if sameValues(existing.values, row.values) {
+				return nil
+			}
+			return &types.RejectedRecord{
+				Reason:          aws.String("a record with the same dimensions, time and measure name exists with a higher or equal version"),
+				ExistingVersion: aws.Int64(existing.version),
+			}
+		}
+		t.rows[i] = row
+	} else {
+		t.index[key] = len(t.rows)
+		t.rows = append(t.rows, row)
+	}
+
+	for _, c := range columns {
+		if !slices.ContainsFunc(t.columns, func(existing emulatedColumn) bool { return existing.name == c.name }) {
+			t.columns = append(t.columns, c)
+		}
+	}
+	return nil
+}
+
+func sameValues(a, b map[string]any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok {
+			return false
+		}
+		if c, ok := compareValues(v, w); !ok || c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// epochConverters build a time from an epoch in each time unit. They avoid
+// scaling to a time.Duration, which overflows beyond about 292 years.
+var epochConverters = map[types.TimeUnit]func(int64) time.Time{
+	"":                         time.UnixMilli,
+	types.TimeUnitSeconds:      func(n int64) time.Time { return time.Unix(n, 0) },
+	types.TimeUnitMilliseconds: time.UnixMilli,
+	types.TimeUnitMicroseconds: time.UnixMicro,
+	types.TimeUnitNanoseconds:  func(n int64) time.Time { return time.Unix(0, n) },
+}
+
+func parseEpoch(s string, unit types.TimeUnit) (time.Time, error) {
+	fromEpoch, ok := epochConverters[unit]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unsupported time unit %s", unit)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fromEpoch(n).UTC(), nil
+}
+
+func parseMeasureValue(s string, valueType types.MeasureValueType, unit types.TimeUnit) (any, querytypes.ScalarType, error) {
+	switch valueType {
+	case types.MeasureValueTypeDouble:
+		f, err := strconv.ParseFloat(s, 64)
+		return f, querytypes.ScalarTypeDouble, err
+	case types.MeasureValueTypeBigint:
+		n, err := strconv.ParseInt(s, 10, 64)
+		return n, querytypes.ScalarTypeBigint, err
+	case types.MeasureValueTypeBoolean:
+		b, err := strconv.ParseBool(s)
+		return b, querytypes.ScalarTypeBoolean, err
+	case types.MeasureValueTypeVarchar:
+		return s, querytypes.ScalarTypeVarchar, nil
+	case types.MeasureValueTypeTimestamp:
+		ts, err := parseEpoch(s, unit)
+		return ts, querytypes.ScalarTypeTimestamp, err
+	default:
+		return nil, "", fmt.Errorf("unsupported measure value type %s", valueType)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Query runs a query against the stored records. See Emulator for the supported
+// SQL subset. Results larger than MaxRows are paginated through NextToken.
+func (e *Emulator) Query(ctx context.Context, params *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var queryID string
+	var page emulatedPage
+	if params.NextToken != nil {
+		var ok bool
+		if page, ok = e.pages[*params.NextToken]; !ok {
+			return nil, queryError("invalid next token %s", *params.NextToken)
+		}
+		delete(e.pages, *params.NextToken)
+		queryID, _, _ = strings.Cut(*params.NextToken, ":")
+	} else {
+		q, err := parseQuery(aws.ToString(params.QueryString))
+		if err != nil {
+			return nil, err
+		}
+		if page.columns, page.rows, err = e.execute(q); err != nil {
+			return nil, err
+		}
+		e.queries++
+		queryID = fmt.Sprintf("emulated-query-%d", e.queries)
+	}
+
+	out := &timestreamquery.QueryOutput{QueryId: aws.String(queryID), ColumnInfo: page.columns, Rows: page.rows}
+	if maxRows := int(aws.ToInt32(params.MaxRows)); maxRows > 0 && len(page.rows) > maxRows {
+		out.Rows = page.rows[:maxRows]
+		token := fmt.Sprintf("%s:%d", queryID, e.queries)
+		e.queries++
+		e.pages[token] = emulatedPage{columns: page.columns, rows: page.rows[maxRows:]}
+		out.NextToken = aws.String(token)
+	}
+	return out, nil
+}
+
+// PrepareQuery validates the query and returns its columns.
+func (e *Emulator) PrepareQuery(ctx context.Context, params *timestreamquery.PrepareQueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.PrepareQueryOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, err := parseQuery(aws.ToString(params.QueryString))
+	if err != nil {
+		return nil, err
+	}
+	columns, _, err := e.execute(q)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &timestreamquery.PrepareQueryOutput{QueryString: params.QueryString}
+	for _, c := range columns {
+		out.Columns = append(out.Columns, querytypes.SelectColumn{Name: c.Name, Type: c.Type})
+	}
+	return out, nil
+}
+
+// CancelQuery drops the pending pages of a paginated query.
+func (e *Emulator) CancelQuery(ctx context.Context, params *timestreamquery.CancelQueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := aws.ToString(params.QueryId)
+	for token := range e.pages {
+		if strings.HasPrefix(token, id+":") {
+			delete(e.pages, token)
+		}
+	}
+	return &timestreamquery.CancelQueryOutput{}, nil
+}
@@ -0,0 +1,314 @@
+package timestreamtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/EvergenEnergy/TimeSchema/pkg/timestreamtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	querytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reading struct {
+	Timestamp   time.Time `timestream:"timestamp"`
+	MeasureName string    `timestream:"measure"`
+	Site        string    `timestream:"dimension,name=site"`
+	Power       float64   `timestream:"attribute,name=power"`
+	Samples     int       `timestream:"attribute,name=samples"`
+}
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newEmulator(t *testing.T) *timestreamtest.Emulator {
+	t.Helper()
+	e := timestreamtest.NewEmulator(timestreamtest.WithClock(func() time.Time { return base.Add(2 * time.Hour) }))
+	ctx := context.Background()
+	_, err := e.CreateDatabase(ctx, &timestreamwrite.CreateDatabaseInput{DatabaseName: aws.String("db")})
+	require.NoError(t, err)
+	_, err = e.CreateTable(ctx, &timestreamwrite.CreateTableInput{DatabaseName: aws.String("db"), TableName: aws.String("readings")})
+	require.NoError(t, err)
+	return e
+}
+
+func seed(t *testing.T, e *timestreamtest.Emulator) {
+	t.Helper()
+	var readings []reading
+	for i := 0; i < 6; i++ {
+		for _, site := range []string{"north", "south"} {
+			power := float64(i)
+			if site == "south" {
+				power *= 10
+			}
+			readings = append(readings, reading{
+				Timestamp:   base.Add(time.Duration(i) * 30 * time.Minute),
+				MeasureName: "energy",
+				Site:        site,
+				Power:       power,
+				Samples:     i + 1,
+			})
+		}
+	}
+
+	w := timestream.NewWriter(e, "db")
+	require.NoError(t, w.Write(context.Background(), "readings", readings))
+	require.NoError(t, w.Close(context.Background()))
+}
+
+func query(t *testing.T, e *timestreamtest.Emulator, sql string) *timestreamquery.QueryOutput {
+	t.Helper()
+	out, err := e.Query(context.Background(), &timestreamquery.QueryInput{QueryString: aws.String(sql)})
+	require.NoError(t, err)
+	return out
+}
+
+func scalars(out *timestreamquery.QueryOutput) [][]string {
+	var rows [][]string
+	for _, row := range out.Rows {
+		var values []string
+		for _, d := range row.Data {
+			if aws.ToBool(d.NullValue) {
+				values = append(values, "NULL")
+			} else {
+				values = append(values, aws.ToString(d.ScalarValue))
+			}
+		}
+		rows = append(rows, values)
+	}
+	return rows
+}
+
+func TestEmulatorRoundTrip(t *testing.T) {
+	e := newEmulator(t)
+	seed(t, e)
+
+	out := query(t, e, `SELECT site, bin(time, 1h) AS hour, avg(power) AS power, sum(samples) AS samples
+		FROM "db"."readings"
+		WHERE time >= '2024-01-01 00:00:00' AND site = 'south'
+		GROUP BY site, bin(time, 1h)
+		ORDER BY hour`)
+
+	var got []struct {
+		Site    string    `timestream:"name=site"`
+		Hour    time.Time `timestream:"name=hour"`
+		Power   float64   `timestream:"name=power"`
+		Samples int64     `timestream:"name=samples"`
+	}
+	require.NoError(t, timestream.Unmarshal(out, &got))
+	if assert.Len(t, got, 3) {
+		assert.Equal(t, "south", got[0].Site)
+		assert.Equal(t, base, got[0].Hour)
+		assert.Equal(t, 5.0, got[0].Power)
+		assert.Equal(t, int64(3), got[0].Samples)
+		assert.Equal(t, base.Add(2*time.Hour), got[2].Hour)
+		assert.Equal(t, 45.0, got[2].Power)
+	}
+
+	assert.Equal(t, []querytypes.ColumnInfo{
+		{Name: aws.String("site"), Type: &querytypes.Type{ScalarType: querytypes.ScalarTypeVarchar}},
+		{Name: aws.String("hour"), Type: &querytypes.Type{ScalarType: querytypes.ScalarTypeTimestamp}},
+		{Name: aws.String("power"), Type: &querytypes.Type{ScalarType: querytypes.ScalarTypeDouble}},
+		{Name: aws.String("samples"), Type: &querytypes.Type{ScalarType: querytypes.ScalarTypeBigint}},
+	}, out.ColumnInfo)
+}
+
+func TestEmulatorQuery(t *testing.T) {
+	e := newEmulator(t)
+	seed(t, e)
+
+	tests := []struct {
+		name string
+		sql  string
+		want [][]string
+	}{
+		{
+			name: "star",
+			sql:  `SELECT * FROM "db"."readings" WHERE site = 'north' AND samples = 1`,
+			want: [][]string{{"north", "energy", "2024-01-01 00:00:00.000000000", "0", "1"}},
+		},
+		{
+			name: "count star without group",
+			sql:  `SELECT count(*) FROM db.readings`,
+			want: [][]string{{"12"}},
+		},
+		{
+			name: "aggregates over no rows",
+			sql:  `SELECT count(power), avg(power) FROM "db"."readings" WHERE site = 'east'`,
+			want: [][]string{{"0", "NULL"}},
+		},
+		{
+			name: "min and max grouped by position",
+			sql:  `SELECT site, min(power), max(time) FROM "db"."readings" GROUP BY 1 ORDER BY 1 DESC`,
+			want: [][]string{
+				{"south", "0", "2024-01-01 02:30:00.000000000"},
+				{"north", "0", "2024-01-01 02:30:00.000000000"},
+			},
+		},
+		{
+			name: "between, in and limit",
+			sql: `SELECT samples FROM "db"."readings"
+				WHERE samples BETWEEN 2 AND 5 AND site IN ('north') AND NOT power = 3
+				ORDER BY samples DESC LIMIT 2`,
+			want: [][]string{{"5"}, {"3"}},
+		},
+		{
+			name: "ago and arithmetic",
+			sql:  `SELECT site, power * 2 FROM "db"."readings" WHERE time > ago(30m) OR power IS NULL ORDER BY site`,
+			want: [][]string{{"north", "8"}, {"north", "10"}, {"south", "80"}, {"south", "100"}},
+		},
+		{
+			name: "timestamp literal and from_milliseconds",
+			sql:  `SELECT from_milliseconds(0) FROM "db"."readings" WHERE time = TIMESTAMP '2024-01-01 02:30:00' AND site = 'south'`,
+			want: [][]string{{"1970-01-01 00:00:00.000000000"}},
+		},
+		{
+			name: "sub-second and far future epochs",
+			sql: `SELECT from_milliseconds(1704067200123), from_unixtime(1.5), from_unixtime(10000000000)
+				FROM "db"."readings" WHERE time = TIMESTAMP '2024-01-01 02:30:00' AND site = 'south'`,
+			want: [][]string{{"2024-01-01 00:00:00.123000000", "1970-01-01 00:00:01.500000000", "2286-11-20 17:46:40.000000000"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, scalars(query(t, e, tt.sql)))
+		})
+	}
+}
+
+func TestEmulatorQueryErrors(t *testing.T) {
+	e := newEmulator(t)
+	seed(t, e)
+
+	for _, sql := range []string{
+		`SELECT power FROM "db"."missing"`,
+		`SELECT missing FROM "db"."readings"`,
+		`SELECT power FROM "db"."readings" WHERE avg(power) > 1`,
+		`SELECT median(power) FROM "db"."readings"`,
+		`SELECT power FROM "db"."readings" WHERE site = 'north`,
+		`SELECT power FROM "db"."readings" GROUP BY 3`,
+		`SELECT power "db"."readings"`,
+	} {
+		_, err := e.Query(context.Background(), &timestreamquery.QueryInput{QueryString: aws.String(sql)})
+		var validation *querytypes.ValidationException
+		assert.True(t, errors.As(err, &validation), sql)
+	}
+}
+
+func TestEmulatorPagination(t *testing.T) {
+	e := newEmulator(t)
+	seed(t, e)
+	ctx := context.Background()
+
+	in := &timestreamquery.QueryInput{QueryString: aws.String(`SELECT samples FROM "db"."readings" ORDER BY time, site`), MaxRows: aws.Int32(5)}
+	var pages int
+	var rows []querytypes.Row
+	for {
+		out, err := e.Query(ctx, in)
+		require.NoError(t, err)
+		pages++
+		rows = append(rows, out.Rows...)
+		assert.Len(t, out.ColumnInfo, 1)
+		if out.NextToken == nil {
+			break
+		}
+		in.NextToken = out.NextToken
+	}
+	assert.Equal(t, 3, pages)
+	assert.Len(t, rows, 12)
+
+	_, err := e.Query(ctx, in)
+	assert.Error(t, err, "a consumed token cannot be reused")
+}
+
+func TestEmulatorVersions(t *testing.T) {
+	e := newEmulator(t)
+	ctx := context.Background()
+
+	record := func(value string, version int64) types.Record {
+		return types.Record{
+			Dimensions:       []types.Dimension{{Name: aws.String("site"), Value: aws.String("north")}},
+			MeasureName:      aws.String("temperature"),
+			MeasureValue:     aws.String(value),
+			MeasureValueType: types.MeasureValueTypeDouble,
+			Time:             aws.String("1704067200"),
+			TimeUnit:         types.TimeUnitSeconds,
+			Version:          aws.Int64(version),
+		}
+	}
+	write := func(records ...types.Record) error {
+		_, err := e.WriteRecords(ctx, &timestreamwrite.WriteRecordsInput{
+			DatabaseName: aws.String("db"),
+			TableName:    aws.String("readings"),
+			Records:      records,
+		})
+		return err
+	}
+
+	require.NoError(t, write(record("20.5", 1)))
+	assert.NoError(t, write(record("20.5", 1)), "identical records are accepted")
+
+	err := write(record("21", 1), record("22", 3))
+	var rejected *types.RejectedRecordsException
+	if assert.ErrorAs(t, err, &rejected) && assert.Len(t, rejected.RejectedRecords, 1) {
+		assert.Equal(t, int32(0), rejected.RejectedRecords[0].RecordIndex)
+		assert.Equal(t, aws.Int64(1), rejected.RejectedRecords[0].ExistingVersion)
+	}
+	assert.Equal(t, [][]string{{"22"}}, scalars(query(t, e, `SELECT "measure_value::double" FROM "db"."readings"`)),
+		"the valid record of a partially rejected batch is stored")
+
+	require.NoError(t, write(record("23", 4)))
+	assert.Equal(t, [][]string{{"north", "temperature", "2024-01-01 00:00:00.000000000", "23"}},
+		scalars(query(t, e, `SELECT * FROM "db"."readings"`)))
+
+	var notFound *types.ResourceNotFoundException
+	_, err = e.WriteRecords(ctx, &timestreamwrite.WriteRecordsInput{
+		DatabaseName: aws.String("db"),
+		TableName:    aws.String("missing"),
+		Records:      []types.Record{record("1", 1)},
+	})
+	assert.ErrorAs(t, err, &notFound)
+}
+
+func TestEmulatorTimeUnits(t *testing.T) {
+	e := newEmulator(t)
+
+	var records []types.Record
+	for _, r := range []struct {
+		time string
+		unit types.TimeUnit
+	}{
+		{"10000000000", types.TimeUnitSeconds},
+		{"10000000000001", types.TimeUnitMilliseconds},
+		{"10000000000000002", types.TimeUnitMicroseconds},
+		{"1704067200000000003", types.TimeUnitNanoseconds},
+	} {
+		records = append(records, types.Record{
+			Dimensions:       []types.Dimension{{Name: aws.String("unit"), Value: aws.String(string(r.unit))}},
+			MeasureName:      aws.String("temperature"),
+			MeasureValue:     aws.String("20"),
+			MeasureValueType: types.MeasureValueTypeDouble,
+			Time:             aws.String(r.time),
+			TimeUnit:         r.unit,
+		})
+	}
+	_, err := e.WriteRecords(context.Background(), &timestreamwrite.WriteRecordsInput{
+		DatabaseName: aws.String("db"),
+		TableName:    aws.String("readings"),
+		Records:      records,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"2024-01-01 00:00:00.000000003"},
+		{"2286-11-20 17:46:40.000000000"},
+		{"2286-11-20 17:46:40.000002000"},
+		{"2286-11-20 17:46:40.001000000"},
+	}, scalars(query(t, e, `SELECT time FROM "db"."readings" ORDER BY time`)))
+}
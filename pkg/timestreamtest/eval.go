@@ -0,0 +1,835 @@
+package timestreamtest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	querytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+)
+
+const timestampLayout = "2006-01-02 15:04:05.000000000"
+
+var aggregates = map[string]bool{"avg": true, "sum": true, "min": true, "max": true, "count": true}
+
+// evalContext is what an expression is evaluated against: a single row, and the
+// rows of its group when aggregating.
+type evalContext struct {
+	row   map[string]any
+	group []map[string]any
+	now   time.Time
+}
+
+// execute runs the query against the stored tables. The caller must hold e.mu.
+func (e *Emulator) execute(q *query) ([]querytypes.ColumnInfo, []querytypes.Row, error) {
+	db, ok := e.databases[q.database]
+	if !ok {
+		return nil, nil, queryError("database %s does not exist", q.database)
+	}
+	t, ok := db.tables[q.table]
+	if !ok {
+		return nil, nil, queryError("table %s does not exist in database %s", q.table, q.database)
+	}
+
+	schema := make(map[string]querytypes.ScalarType, len(t.columns))
+	for _, c := range t.columns {
+		schema[c.name] = c.valueType
+	}
+
+	items, err := expandStar(q.items, t.columns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make([]querytypes.ColumnInfo, len(items))
+	for i, item := range items {
+		scalarType, err := typeOf(item.expr, schema)
+		if err != nil {
+			return nil, nil, err
+		}
+		columns[i] = querytypes.ColumnInfo{Name: aws.String(columnName(item, i)), Type: &querytypes.Type{ScalarType: scalarType}}
+	}
+
+	if q.where != nil {
+		if containsAggregate(q.where) {
+			return nil, nil, queryError("aggregates are not allowed in WHERE")
+		}
+		if _, err := typeOf(q.where, schema); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	groupBy := make([]expr, len(q.groupBy))
+	for i, g := range q.groupBy {
+		if groupBy[i], err = resolveReference(g, items, schema); err != nil {
+			return nil, nil, err
+		}
+		if containsAggregate(groupBy[i]) {
+			return nil, nil, queryError("aggregates are not allowed in GROUP BY")
+		}
+		if _, err := typeOf(groupBy[i], schema); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	orderBy := make([]orderItem, len(q.orderBy))
+	for i, o := range q.orderBy {
+		resolved, err := resolveReference(o.expr, items, schema)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := typeOf(resolved, schema); err != nil {
+			return nil, nil, err
+		}
+		orderBy[i] = orderItem{expr: resolved, desc: o.desc}
+	}
+
+	now := e.now().UTC()
+	var matched []map[string]any
+	for _, row := range t.rows {
+		if q.where != nil {
+			v, err := eval(q.where, evalContext{row: row.values, now: now})
+			if err != nil {
+				return nil, nil, err
+			}
+			if v != true {
+				continue
+			}
+		}
+		matched = append(matched, row.values)
+	}
+
+	aggregated := len(groupBy) > 0
+	for _, item := range items {
+		aggregated = aggregated || containsAggregate(item.expr)
+	}
+	for _, o := range orderBy {
+		aggregated = aggregated || containsAggregate(o.expr)
+	}
+
+	var contexts []evalContext
+	switch {
+	case !aggregated:
+		for _, row := range matched {
+			contexts = append(contexts, evalContext{row: row, now: now})
+		}
+	case len(groupBy) == 0:
+		ctx := evalContext{row: map[string]any{}, group: matched, now: now}
+		if len(matched) > 0 {
+			ctx.row = matched[0]
+		}
+		contexts = append(contexts, ctx)
+	default:
+		index := make(map[string]int)
+		for _, row := range matched {
+			var key strings.Builder
+			for _, g := range groupBy {
+				v, err := eval(g, evalContext{row: row, now: now})
+				if err != nil {
+					return nil, nil, err
+				}
+				fmt.Fprintf(&key, "%T:%v\x00", v, v)
+			}
+			i, ok := index[key.String()]
+			if !ok {
+				i = len(contexts)
+				index[key.String()] = i
+				contexts = append(contexts, evalContext{row: row, now: now})
+			}
+			contexts[i].group = append(contexts[i].group, row)
+		}
+	}
+
+	type result struct {
+		values   []any
+		sortKeys []any
+	}
+	results := make([]result, len(contexts))
+	for i, ctx := range contexts {
+		for _, item := range items {
+			v, err := eval(item.expr, ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			results[i].values = append(results[i].values, v)
+		}
+		for _, o := range orderBy {
+			v, err := eval(o.expr, ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			results[i].sortKeys = append(results[i].sortKeys, v)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		for k, o := range orderBy {
+			a, b := results[i].sortKeys[k], results[j].sortKeys[k]
+			// NULLs sort last in either direction.
+			if a == nil || b == nil {
+				if (a == nil) != (b == nil) {
+					return b == nil
+				}
+				continue
+			}
+			c, _ := compareValues(a, b)
+			if c != 0 {
+				return (c < 0) != o.desc
+			}
+		}
+		return false
+	})
+
+	if q.limit >= 0 && len(results) > q.limit {
+		results = results[:q.limit]
+	}
+
+	rows := make([]querytypes.Row, len(results))
+	for i, r := range results {
+		for _, v := range r.values {
+			rows[i].Data = append(rows[i].Data, toDatum(v))
+		}
+	}
+	return columns, rows, nil
+}
+
+// expandStar replaces * with the table columns, ordered as Timestream does: the
+// dimensions first, then measure_name, time and the measures.
+func expandStar(items []selectItem, columns []emulatedColumn) ([]selectItem, error) {
+	var expanded []selectItem
+	for _, item := range items {
+		if !item.star {
+			expanded = append(expanded, item)
+			continue
+		}
+		ordered := append([]emulatedColumn(nil), columns...)
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].kind < ordered[j].kind })
+		for _, c := range ordered {
+			expanded = append(expanded, selectItem{expr: columnRef{name: c.name}})
+		}
+	}
+	if len(expanded) == 0 {
+		return nil, queryError("table has no columns to select")
+	}
+	return expanded, nil
+}
+
+func columnName(item selectItem, i int) string {
+	if item.alias != "" {
+		return item.alias
+	}
+	if ref, ok := item.expr.(columnRef); ok {
+		return ref.name
+	}
+	return "_col" + strconv.Itoa(i)
+}
+
+// resolveReference resolves positions and select aliases used in GROUP BY and
+// ORDER BY to the selected expression. Table columns take precedence over aliases.
+func resolveReference(e expr, items []selectItem, schema map[string]querytypes.ScalarType) (expr, error) {
+	switch e := e.(type) {
+	case literal:
+		n, ok := e.value.(int64)
+		if !ok {
+			return e, nil
+		}
+		if n < 1 || int(n) > len(items) {
+			return nil, queryError("position %d is not in the select list", n)
+		}
+		return items[n-1].expr, nil
+	case columnRef:
+		if _, ok := schema[e.name]; ok {
+			return e, nil
+		}
+		for _, item := range items {
+			if item.alias == e.name {
+				return item.expr, nil
+			}
+		}
+	}
+	return e, nil
+}
+
+func containsAggregate(e expr) bool {
+	switch e := e.(type) {
+	case callExpr:
+		if aggregates[e.name] {
+			return true
+		}
+		for _, arg := range e.args {
+			if containsAggregate(arg) {
+				return true
+			}
+		}
+	case unaryExpr:
+		return containsAggregate(e.operand)
+	case binaryExpr:
+		return containsAggregate(e.left) || containsAggregate(e.right)
+	case betweenExpr:
+		return containsAggregate(e.operand) || containsAggregate(e.low) || containsAggregate(e.high)
+	case inExpr:
+		if containsAggregate(e.operand) {
+			return true
+		}
+		for _, item := range e.list {
+			if containsAggregate(item) {
+				return true
+			}
+		}
+	case isNullExpr:
+		return containsAggregate(e.operand)
+	}
+	return false
+}
+
+// typeOf infers the scalar type of an expression, reporting unknown columns and
+// functions, and wrong numbers of arguments.
+func typeOf(e expr, schema map[string]querytypes.ScalarType) (querytypes.ScalarType, error) {
+	switch e := e.(type) {
+	case columnRef:
+		t, ok := schema[e.name]
+		if !ok {
+			return "", queryError("column %s does not exist", e.name)
+		}
+		return t, nil
+	case literal:
+		switch e.value.(type) {
+		case string:
+			return querytypes.ScalarTypeVarchar, nil
+		case int64:
+			return querytypes.ScalarTypeBigint, nil
+		case float64:
+			return querytypes.ScalarTypeDouble, nil
+		case bool:
+			return querytypes.ScalarTypeBoolean, nil
+		case time.Time:
+			return querytypes.ScalarTypeTimestamp, nil
+		case time.Duration:
+			return querytypes.ScalarTypeIntervalDayToSecond, nil
+		default:
+			return querytypes.ScalarTypeUnknown, nil
+		}
+	case unaryExpr:
+		t, err := typeOf(e.operand, schema)
+		if e.op == "NOT" {
+			return querytypes.ScalarTypeBoolean, err
+		}
+		return t, err
+	case binaryExpr:
+		left, err := typeOf(e.left, schema)
+		if err != nil {
+			return "", err
+		}
+		right, err := typeOf(e.right, schema)
+		if err != nil {
+			return "", err
+		}
+		switch e.op {
+		case "+", "-", "*", "/", "%":
+			switch {
+			case left == querytypes.ScalarTypeTimestamp || right == querytypes.ScalarTypeTimestamp:
+				return querytypes.ScalarTypeTimestamp, nil
+			case left == querytypes.ScalarTypeBigint && right == querytypes.ScalarTypeBigint:
+				return querytypes.ScalarTypeBigint, nil
+			default:
+				return querytypes.ScalarTypeDouble, nil
+			}
+		default:
+			return querytypes.ScalarTypeBoolean, nil
+		}
+	case betweenExpr:
+		for _, operand := range []expr{e.operand, e.low, e.high} {
+			if _, err := typeOf(operand, schema); err != nil {
+				return "", err
+			}
+		}
+		return querytypes.ScalarTypeBoolean, nil
+	case inExpr:
+		for _, operand := range append([]expr{e.operand}, e.list...) {
+			if _, err := typeOf(operand, schema); err != nil {
+				return "", err
+			}
+		}
+		return querytypes.ScalarTypeBoolean, nil
+	case isNullExpr:
+		_, err := typeOf(e.operand, schema)
+		return querytypes.ScalarTypeBoolean, err
+	case callExpr:
+		return typeOfCall(e, schema)
+	default:
+		return "", queryError("unsupported expression %T", e)
+	}
+}
+
+func typeOfCall(e callExpr, schema map[string]querytypes.ScalarType) (querytypes.ScalarType, error) {
+	args := make([]querytypes.ScalarType, len(e.args))
+	for i, arg := range e.args {
+		if aggregates[e.name] && containsAggregate(arg) {
+			return "", queryError("nested aggregate in %s", e.name)
+		}
+		var err error
+		if args[i], err = typeOf(arg, schema); err != nil {
+			return "", err
+		}
+	}
+
+	arity := map[string]int{
+		"avg": 1, "sum": 1, "min": 1, "max": 1, "bin": 2,
+		"ago": 1, "now": 0, "from_unixtime": 1, "from_milliseconds": 1, "from_nanoseconds": 1,
+	}
+	if e.name == "count" {
+		if !e.star && len(args) != 1 {
+			return "", queryError("count expects * or one argument")
+		}
+		return querytypes.ScalarTypeBigint, nil
+	}
+	n, ok := arity[e.name]
+	if !ok {
+		return "", queryError("function %s is not supported", e.name)
+	}
+	if e.star || len(args) != n {
+		return "", queryError("%s expects %d arguments", e.name, n)
+	}
+
+	switch e.name {
+	case "avg":
+		return querytypes.ScalarTypeDouble, nil
+	case "sum":
+		if args[0] == querytypes.ScalarTypeBigint {
+			return querytypes.ScalarTypeBigint, nil
+		}
+		return querytypes.ScalarTypeDouble, nil
+	case "min", "max":
+		return args[0], nil
+	default:
+		return querytypes.ScalarTypeTimestamp, nil
+	}
+}
+
+func eval(e expr, ctx evalContext) (any, error) {
+	switch e := e.(type) {
+	case columnRef:
+		return ctx.row[e.name], nil
+	case literal:
+		return e.value, nil
+	case unaryExpr:
+		v, err := eval(e.operand, ctx)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		if e.op == "NOT" {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, queryError("NOT expects a boolean, got %v", v)
+			}
+			return !b, nil
+		}
+		switch n := v.(type) {
+		case int64:
+			return -n, nil
+		case float64:
+			return -n, nil
+		case time.Duration:
+			return -n, nil
+		}
+		return nil, queryError("cannot negate %v", v)
+	case binaryExpr:
+		return evalBinary(e, ctx)
+	case betweenExpr:
+		v, err := evalAll(ctx, e.operand, e.low, e.high)
+		if err != nil || v[0] == nil || v[1] == nil || v[2] == nil {
+			return nil, err
+		}
+		low, lok := compareValues(v[0], v[1])
+		high, hok := compareValues(v[0], v[2])
+		if !lok || !hok {
+			return nil, queryError("cannot compare %v with %v and %v", v[0], v[1], v[2])
+		}
+		return (low >= 0 && high <= 0) != e.not, nil
+	case inExpr:
+		v, err := eval(e.operand, ctx)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		for _, item := range e.list {
+			w, err := eval(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if c, ok := compareValues(v, w); ok && c == 0 {
+				return !e.not, nil
+			}
+		}
+		return e.not, nil
+	case isNullExpr:
+		v, err := eval(e.operand, ctx)
+		return (v == nil) != e.not, err
+	case callExpr:
+		if aggregates[e.name] {
+			return evalAggregate(e, ctx)
+		}
+		return evalCall(e, ctx)
+	default:
+		return nil, queryError("unsupported expression %T", e)
+	}
+}
+
+func evalAll(ctx evalContext, exprs ...expr) ([]any, error) {
+	values := make([]any, len(exprs))
+	for i, e := range exprs {
+		var err error
+		if values[i], err = eval(e, ctx); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func evalBinary(e binaryExpr, ctx evalContext) (any, error) {
+	v, err := evalAll(ctx, e.left, e.right)
+	if err != nil {
+		return nil, err
+	}
+	left, right := v[0], v[1]
+
+	switch e.op {
+	case "AND", "OR":
+		// Three-valued logic: a NULL operand only matters when the other one does
+		// not decide the result.
+		l, lok := left.(bool)
+		r, rok := right.(bool)
+		if (left != nil && !lok) || (right != nil && !rok) {
+			return nil, queryError("%s expects booleans, got %v and %v", e.op, left, right)
+		}
+		decisive := e.op == "OR"
+		if (lok && l == decisive) || (rok && r == decisive) {
+			return decisive, nil
+		}
+		if !lok || !rok {
+			return nil, nil
+		}
+		return !decisive, nil
+	}
+
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	switch e.op {
+	case "=", "<>", "<", "<=", ">", ">=":
+		c, ok := compareValues(left, right)
+		if !ok {
+			return nil, queryError("cannot compare %v with %v", left, right)
+		}
+		switch e.op {
+		case "=":
+			return c == 0, nil
+		case "<>":
+			return c != 0, nil
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+
+	if ts, ok := left.(time.Time); ok {
+		if d, ok := right.(time.Duration); ok && (e.op == "+" || e.op == "-") {
+			if e.op == "-" {
+				d = -d
+			}
+			return ts.Add(d), nil
+		}
+	}
+	if d, ok := left.(time.Duration); ok && e.op == "+" {
+		if ts, ok := right.(time.Time); ok {
+			return ts.Add(d), nil
+		}
+	}
+
+	l, lint := left.(int64)
+	r, rint := right.(int64)
+	if lint && rint {
+		switch e.op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		}
+		if r == 0 {
+			return nil, queryError("division by zero")
+		}
+		if e.op == "/" {
+			return l / r, nil
+		}
+		return l % r, nil
+	}
+
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, queryError("cannot apply %s to %v and %v", e.op, left, right)
+	}
+	switch e.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		return lf / rf, nil
+	default:
+		return math.Mod(lf, rf), nil
+	}
+}
+
+func evalCall(e callExpr, ctx evalContext) (any, error) {
+	args, err := evalAll(ctx, e.args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+	}
+
+	switch e.name {
+	case "now":
+		return ctx.now, nil
+	case "ago":
+		d, ok := args[0].(time.Duration)
+		if !ok {
+			return nil, queryError("ago expects a duration, got %v", args[0])
+		}
+		return ctx.now.Add(-d), nil
+	case "bin":
+		ts, ok := toTime(args[0])
+		d, dok := args[1].(time.Duration)
+		if !ok || !dok || d <= 0 {
+			return nil, queryError("bin expects a timestamp and a positive duration, got %v and %v", args[0], args[1])
+		}
+		// Bins are aligned on the Unix epoch rather than on Go's zero time.
+		n := ts.UnixNano()
+		rem := n % int64(d)
+		if rem < 0 {
+			rem += int64(d)
+		}
+		return time.Unix(0, n-rem).UTC(), nil
+	case "from_nanoseconds":
+		n, ok := args[0].(int64)
+		if !ok {
+			return nil, queryError("from_nanoseconds expects a BIGINT, got %v", args[0])
+		}
+		return time.Unix(0, n).UTC(), nil
+	case "from_unixtime", "from_milliseconds":
+		// Integers convert exactly, as neither a float64 nor an int64 count of
+		// nanoseconds covers the full range of second and millisecond epochs.
+		if n, ok := args[0].(int64); ok {
+			if e.name == "from_milliseconds" {
+				return time.UnixMilli(n).UTC(), nil
+			}
+			return time.Unix(n, 0).UTC(), nil
+		}
+		f, ok := toFloat(args[0])
+		if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, queryError("%s expects a number, got %v", e.name, args[0])
+		}
+		if e.name == "from_milliseconds" {
+			f /= 1000
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*float64(time.Second)))).UTC(), nil
+	default:
+		return nil, queryError("function %s is not supported", e.name)
+	}
+}
+
+func evalAggregate(e callExpr, ctx evalContext) (any, error) {
+	var values []any
+	for _, row := range ctx.group {
+		if e.star {
+			values = append(values, true)
+			continue
+		}
+		v, err := eval(e.args[0], evalContext{row: row, now: ctx.now})
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			values = append(values, v)
+		}
+	}
+
+	if e.name == "count" {
+		return int64(len(values)), nil
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	switch e.name {
+	case "min", "max":
+		best := values[0]
+		for _, v := range values[1:] {
+			c, ok := compareValues(v, best)
+			if !ok {
+				return nil, queryError("cannot compare %v with %v", v, best)
+			}
+			if (c < 0) == (e.name == "min") && c != 0 {
+				best = v
+			}
+		}
+		return best, nil
+	case "sum":
+		if _, ok := values[0].(int64); ok {
+			var sum int64
+			for _, v := range values {
+				n, ok := v.(int64)
+				if !ok {
+					return nil, queryError("sum expects numbers, got %v", v)
+				}
+				sum += n
+			}
+			return sum, nil
+		}
+		fallthrough
+	default:
+		var sum float64
+		for _, v := range values {
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, queryError("%s expects numbers, got %v", e.name, v)
+			}
+			sum += f
+		}
+		if e.name == "avg" {
+			return sum / float64(len(values)), nil
+		}
+		return sum, nil
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func toTime(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		ts, err := parseTimestamp(t)
+		return ts, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+// compareValues orders two non-NULL values, reporting false when they are not
+// comparable. Numbers compare across BIGINT and DOUBLE, and strings are read as
+// timestamps when compared with one.
+func compareValues(a, b any) (int, bool) {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		return compareOrdered(af, bf), true
+	}
+
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+		if b, ok := b.(time.Time); ok {
+			ts, ok := toTime(a)
+			return ts.Compare(b), ok
+		}
+	case time.Time:
+		if b, ok := toTime(b); ok {
+			return a.Compare(b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, true
+			case b:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	case time.Duration:
+		if b, ok := b.(time.Duration); ok {
+			return compareOrdered(a, b), true
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toDatum(v any) querytypes.Datum {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return querytypes.Datum{NullValue: aws.Bool(true)}
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		s = strconv.FormatBool(v)
+	case time.Time:
+		s = v.UTC().Format(timestampLayout)
+	case time.Duration:
+		s = formatInterval(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	return querytypes.Datum{ScalarValue: aws.String(s)}
+}
+
+// formatInterval formats a duration as Timestream does for INTERVAL_DAY_TO_SECOND,
+// e.g. "1 02:03:04.000000000".
+func formatInterval(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	day := 24 * time.Hour
+	return fmt.Sprintf("%s%d %02d:%02d:%02d.%09d", sign,
+		d/day, d%day/time.Hour, d%time.Hour/time.Minute, d%time.Minute/time.Second, d%time.Second)
+}
@@ -0,0 +1,277 @@
+// Package timestreamtest provides in-memory implementations of the timestream
+// WriteAPI and QueryAPI interfaces for tests.
+package timestreamtest
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+)
+
+var (
+	_ timestream.WriteAPI = (*FakeWriteClient)(nil)
+	_ timestream.QueryAPI = (*FakeQueryClient)(nil)
+)
+
+// errorQueue hands out scripted errors, one per call, before falling back to nil.
+type errorQueue struct {
+	errs []error
+}
+
+func (q *errorQueue) next() error {
+	if len(q.errs) == 0 {
+		return nil
+	}
+	err := q.errs[0]
+	q.errs = q.errs[1:]
+	return err
+}
+
+// FakeWriteClient is a WriteAPI recording every request it receives. Calls succeed
+// with empty outputs unless errors were scripted with FailWith.
+// It is safe for concurrent use.
+type FakeWriteClient struct {
+	mu       sync.Mutex
+	requests []any
+	errs     errorQueue
+}
+
+// NewFakeWriteClient returns an empty FakeWriteClient.
+func NewFakeWriteClient() *FakeWriteClient {
+	return &FakeWriteClient{}
+}
+
+// FailWith scripts the errors returned by the next calls, one per call, in order.
+// A nil error lets the matching call succeed.
+func (c *FakeWriteClient) FailWith(errs ...error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs.errs = append(c.errs.errs, errs...)
+}
+
+// Requests returns the inputs of every call received, in order.
+func (c *FakeWriteClient) Requests() []any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]any(nil), c.requests...)
+}
+
+// WriteRequests returns the inputs of the WriteRecords calls received, in order.
+func (c *FakeWriteClient) WriteRequests() []*timestreamwrite.WriteRecordsInput {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var inputs []*timestreamwrite.WriteRecordsInput
+	for _, r := range c.requests {
+		if in, ok := r.(*timestreamwrite.WriteRecordsInput); ok {
+			inputs = append(inputs, in)
+		}
+	}
+	return inputs
+}
+
+func (c *FakeWriteClient) record(ctx context.Context, params any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, params)
+	return c.errs.next()
+}
+
+// WriteRecords records the request.
+func (c *FakeWriteClient) WriteRecords(ctx context.Context, params *timestreamwrite.WriteRecordsInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.WriteRecordsOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.WriteRecordsOutput{}, nil
+}
+
+// CreateDatabase records the request.
+func (c *FakeWriteClient) CreateDatabase(ctx context.Context, params *timestreamwrite.CreateDatabaseInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.CreateDatabaseOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.CreateDatabaseOutput{}, nil
+}
+
+// DescribeDatabase records the request.
+func (c *FakeWriteClient) DescribeDatabase(ctx context.Context, params *timestreamwrite.DescribeDatabaseInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.DescribeDatabaseOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.DescribeDatabaseOutput{}, nil
+}
+
+// ListDatabases records the request.
+func (c *FakeWriteClient) ListDatabases(ctx context.Context, params *timestreamwrite.ListDatabasesInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.ListDatabasesOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.ListDatabasesOutput{}, nil
+}
+
+// UpdateDatabase records the request.
+func (c *FakeWriteClient) UpdateDatabase(ctx context.Context, params *timestreamwrite.UpdateDatabaseInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.UpdateDatabaseOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.UpdateDatabaseOutput{}, nil
+}
+
+// DeleteDatabase records the request.
+func (c *FakeWriteClient) DeleteDatabase(ctx context.Context, params *timestreamwrite.DeleteDatabaseInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.DeleteDatabaseOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.DeleteDatabaseOutput{}, nil
+}
+
+// CreateTable records the request.
+func (c *FakeWriteClient) CreateTable(ctx context.Context, params *timestreamwrite.CreateTableInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.CreateTableOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.CreateTableOutput{}, nil
+}
+
+// DescribeTable records the request.
+func (c *FakeWriteClient) DescribeTable(ctx context.Context, params *timestreamwrite.DescribeTableInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.DescribeTableOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.DescribeTableOutput{}, nil
+}
+
+// ListTables records the request.
+func (c *FakeWriteClient) ListTables(ctx context.Context, params *timestreamwrite.ListTablesInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.ListTablesOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.ListTablesOutput{}, nil
+}
+
+// UpdateTable records the request.
+func (c *FakeWriteClient) UpdateTable(ctx context.Context, params *timestreamwrite.UpdateTableInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.UpdateTableOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.UpdateTableOutput{}, nil
+}
+
+// DeleteTable records the request.
+func (c *FakeWriteClient) DeleteTable(ctx context.Context, params *timestreamwrite.DeleteTableInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.DeleteTableOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamwrite.DeleteTableOutput{}, nil
+}
+
+// FakeQueryClient is a QueryAPI answering every query with the same scripted pages.
+// The first page is returned for a request without a NextToken, and every page but
+// the last one carries the NextToken of the following page. Requests are recorded,
+// and errors can be scripted with FailWith. It is safe for concurrent use.
+type FakeQueryClient struct {
+	mu       sync.Mutex
+	pages    []*timestreamquery.QueryOutput
+	requests []any
+	errs     errorQueue
+}
+
+// NewFakeQueryClient returns a FakeQueryClient answering queries with pages.
+func NewFakeQueryClient(pages ...*timestreamquery.QueryOutput) *FakeQueryClient {
+	return &FakeQueryClient{pages: pages}
+}
+
+// FailWith scripts the errors returned by the next calls, one per call, in order.
+// A nil error lets the matching call succeed.
+func (c *FakeQueryClient) FailWith(errs ...error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs.errs = append(c.errs.errs, errs...)
+}
+
+// Requests returns the inputs of every call received, in order.
+func (c *FakeQueryClient) Requests() []any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]any(nil), c.requests...)
+}
+
+// QueryRequests returns the inputs of the Query calls received, in order.
+func (c *FakeQueryClient) QueryRequests() []*timestreamquery.QueryInput {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var inputs []*timestreamquery.QueryInput
+	for _, r := range c.requests {
+		if in, ok := r.(*timestreamquery.QueryInput); ok {
+			inputs = append(inputs, in)
+		}
+	}
+	return inputs
+}
+
+func (c *FakeQueryClient) record(ctx context.Context, params any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, params)
+	return c.errs.next()
+}
+
+// Query returns the page matching the NextToken of the request.
+func (c *FakeQueryClient) Query(ctx context.Context, params *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+
+	page := 0
+	if params.NextToken != nil {
+		var err error
+		page, err = strconv.Atoi(*params.NextToken)
+		if err != nil || page < 1 || page >= len(c.pages) {
+			return nil, &types.ValidationException{Message: aws.String("invalid next token " + strconv.Quote(*params.NextToken))}
+		}
+	}
+	if len(c.pages) == 0 {
+		return &timestreamquery.QueryOutput{QueryId: aws.String("fake-query")}, nil
+	}
+
+	out := *c.pages[page]
+	out.NextToken = nil
+	if page+1 < len(c.pages) {
+		out.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	if out.QueryId == nil {
+		out.QueryId = aws.String("fake-query")
+	}
+	return &out, nil
+}
+
+// PrepareQuery records the request and echoes the query string back.
+func (c *FakeQueryClient) PrepareQuery(ctx context.Context, params *timestreamquery.PrepareQueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.PrepareQueryOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamquery.PrepareQueryOutput{QueryString: params.QueryString}, nil
+}
+
+// CancelQuery records the request.
+func (c *FakeQueryClient) CancelQuery(ctx context.Context, params *timestreamquery.CancelQueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	if err := c.record(ctx, params); err != nil {
+		return nil, err
+	}
+	return &timestreamquery.CancelQueryOutput{}, nil
+}
@@ -0,0 +1,61 @@
+package timestreamtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/EvergenEnergy/TimeSchema/pkg/timestreamtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeWriteClient(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	client.FailWith(errors.New("boom"), nil)
+	ctx := context.Background()
+
+	_, err := client.WriteRecords(ctx, &timestreamwrite.WriteRecordsInput{TableName: aws.String("first")})
+	assert.Error(t, err)
+	_, err = client.CreateTable(ctx, &timestreamwrite.CreateTableInput{TableName: aws.String("table")})
+	assert.NoError(t, err)
+	_, err = client.WriteRecords(ctx, &timestreamwrite.WriteRecordsInput{TableName: aws.String("second")})
+	assert.NoError(t, err)
+
+	assert.Len(t, client.Requests(), 3)
+	writes := client.WriteRequests()
+	if assert.Len(t, writes, 2) {
+		assert.Equal(t, "first", *writes[0].TableName)
+		assert.Equal(t, "second", *writes[1].TableName)
+	}
+}
+
+func TestFakeQueryClient(t *testing.T) {
+	client := timestreamtest.NewFakeQueryClient(
+		&timestreamquery.QueryOutput{Rows: []types.Row{{}, {}}},
+		&timestreamquery.QueryOutput{Rows: []types.Row{{}}},
+	)
+	ctx := context.Background()
+
+	first, err := client.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String("SELECT 1")})
+	assert.NoError(t, err)
+	assert.Len(t, first.Rows, 2)
+	if assert.NotNil(t, first.NextToken) {
+		second, err := client.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String("SELECT 1"), NextToken: first.NextToken})
+		assert.NoError(t, err)
+		assert.Len(t, second.Rows, 1)
+		assert.Nil(t, second.NextToken)
+	}
+
+	_, err = client.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String("SELECT 1"), NextToken: aws.String("42")})
+	assert.Error(t, err)
+	assert.Len(t, client.QueryRequests(), 3)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = client.Query(cancelled, &timestreamquery.QueryInput{QueryString: aws.String("SELECT 1")})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,639 @@
+package timestreamtest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	querytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+)
+
+func queryError(format string, args ...any) error {
+	return &querytypes.ValidationException{Message: aws.String(fmt.Sprintf(format, args...))}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenDuration
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// is reports whether the token is the given symbol or, case-insensitively, the
+// given unquoted keyword.
+func (t token) is(text string) bool {
+	switch t.kind {
+	case tokenSymbol:
+		return t.text == text
+	case tokenIdent:
+		return strings.EqualFold(t.text, text)
+	default:
+		return false
+	}
+}
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func lex(sql string) ([]token, error) {
+	var tokens []token
+	runes := []rune(sql)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			continue
+		case r == '\'' || r == '"':
+			var sb strings.Builder
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, queryError("unterminated quoted text at position %d", start)
+				}
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						sb.WriteRune(r)
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+			}
+			kind := tokenString
+			if r == '"' {
+				kind = tokenQuotedIdent
+			}
+			tokens = append(tokens, token{kind: kind, text: sb.String(), pos: start})
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') && i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '-' || runes[i+1] == '+') {
+				for i += 2; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+				}
+			}
+			unitStart := i
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			kind := tokenNumber
+			if unitStart < i {
+				if _, ok := durationUnits[string(runes[unitStart:i])]; !ok {
+					return nil, queryError("invalid number %s at position %d", string(runes[start:i]), start)
+				}
+				kind = tokenDuration
+			}
+			tokens = append(tokens, token{kind: kind, text: string(runes[start:i]), pos: start})
+		case isIdentRune(r):
+			for i < len(runes) && isIdentRune(runes[i]) {
+				i++
+			}
+			// measure_value::double and alike are column names rather than casts.
+			if i+2 < len(runes) && runes[i] == ':' && runes[i+1] == ':' && unicode.IsLetter(runes[i+2]) {
+				for i += 2; i < len(runes) && isIdentRune(runes[i]); i++ {
+				}
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+		default:
+			text := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "<=", ">=", "<>", "!=":
+					text = two
+				}
+			}
+			if !strings.Contains("(),.*=<>+-/%", text) && len(text) == 1 {
+				return nil, queryError("unexpected character %q at position %d", r, start)
+			}
+			i += len([]rune(text))
+			tokens = append(tokens, token{kind: tokenSymbol, text: text, pos: start})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+type expr interface{}
+
+type (
+	columnRef struct {
+		name string
+	}
+	literal struct {
+		value any
+	}
+	unaryExpr struct {
+		op      string
+		operand expr
+	}
+	binaryExpr struct {
+		op          string
+		left, right expr
+	}
+	callExpr struct {
+		name string
+		args []expr
+		star bool
+	}
+	betweenExpr struct {
+		operand, low, high expr
+		not                bool
+	}
+	inExpr struct {
+		operand expr
+		list    []expr
+		not     bool
+	}
+	isNullExpr struct {
+		operand expr
+		not     bool
+	}
+)
+
+type selectItem struct {
+	expr  expr
+	alias string
+	star  bool
+}
+
+type orderItem struct {
+	expr expr
+	desc bool
+}
+
+type query struct {
+	database, table string
+	items           []selectItem
+	where           expr
+	groupBy         []expr
+	orderBy         []orderItem
+	limit           int
+}
+
+var reservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true, "ORDER": true,
+	"LIMIT": true, "AS": true, "AND": true, "OR": true, "NOT": true, "BETWEEN": true,
+	"IN": true, "IS": true, "NULL": true, "TRUE": true, "FALSE": true, "ASC": true, "DESC": true,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parseQuery(sql string) (*query, error) {
+	tokens, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	q, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.unexpected()
+	}
+	return q, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(text string) bool {
+	if p.peek().is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return queryError("expected %s at position %d", text, p.peek().pos)
+	}
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return queryError("unexpected end of query")
+	}
+	return queryError("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *parser) parseIdent() (string, error) {
+	t := p.peek()
+	if t.kind == tokenQuotedIdent || (t.kind == tokenIdent && !reservedWords[strings.ToUpper(t.text)]) {
+		p.pos++
+		return t.text, nil
+	}
+	return "", p.unexpected()
+}
+
+func (p *parser) parseSelect() (*query, error) {
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+
+	q := &query{limit: -1}
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		q.items = append(q.items, item)
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if q.database, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("."); err != nil {
+		return nil, err
+	}
+	if q.table, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+
+	if p.accept("WHERE") {
+		if q.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.accept("GROUP") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			q.groupBy = append(q.groupBy, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if p.accept("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := orderItem{expr: e}
+			if p.accept("DESC") {
+				item.desc = true
+			} else {
+				p.accept("ASC")
+			}
+			q.orderBy = append(q.orderBy, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if p.accept("LIMIT") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != tokenNumber || err != nil || n < 0 {
+			return nil, queryError("invalid limit %q at position %d", t.text, t.pos)
+		}
+		q.limit = n
+	}
+	return q, nil
+}
+
+func (p *parser) parseSelectItem() (selectItem, error) {
+	if p.accept("*") {
+		return selectItem{star: true}, nil
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return selectItem{}, err
+	}
+	item := selectItem{expr: e}
+	if p.accept("AS") {
+		item.alias, err = p.parseIdent()
+		return item, err
+	}
+	if t := p.peek(); t.kind == tokenQuotedIdent || (t.kind == tokenIdent && !reservedWords[strings.ToUpper(t.text)]) {
+		item.alias, err = p.parseIdent()
+	}
+	return item, err
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("NOT") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: "NOT", operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"=", "<>", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			if op == "!=" {
+				op = "<>"
+			}
+			return binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+
+	if p.accept("IS") {
+		not := p.accept("NOT")
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return isNullExpr{operand: left, not: not}, nil
+	}
+
+	not := p.accept("NOT")
+	switch {
+	case p.accept("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return betweenExpr{operand: left, low: low, high: high, not: not}, nil
+	case p.accept("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		in := inExpr{operand: left, not: not}
+		for {
+			e, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return in, p.expect(")")
+	case not:
+		return nil, p.unexpected()
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !op.is("+") && !op.is("-") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !op.is("*") && !op.is("/") && !op.is("%") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: "-", operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenString:
+		p.pos++
+		return literal{value: t.text}, nil
+	case tokenNumber:
+		p.pos++
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return literal{value: n}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, queryError("invalid number %s at position %d", t.text, t.pos)
+		}
+		return literal{value: f}, nil
+	case tokenDuration:
+		p.pos++
+		split := strings.IndexFunc(t.text, unicode.IsLetter)
+		n, err := strconv.ParseFloat(t.text[:split], 64)
+		if err != nil {
+			return nil, queryError("invalid duration %s at position %d", t.text, t.pos)
+		}
+		return literal{value: time.Duration(n * float64(durationUnits[t.text[split:]]))}, nil
+	case tokenQuotedIdent:
+		p.pos++
+		return columnRef{name: t.text}, nil
+	case tokenSymbol:
+		if p.accept("(") {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		}
+		return nil, p.unexpected()
+	case tokenIdent:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			p.pos++
+			return literal{value: nil}, nil
+		case "TRUE", "FALSE":
+			p.pos++
+			return literal{value: strings.EqualFold(t.text, "TRUE")}, nil
+		case "TIMESTAMP":
+			if p.tokens[p.pos+1].kind == tokenString {
+				p.pos += 2
+				ts, err := parseTimestamp(p.tokens[p.pos-1].text)
+				if err != nil {
+					return nil, queryError("invalid timestamp %q at position %d", p.tokens[p.pos-1].text, t.pos)
+				}
+				return literal{value: ts}, nil
+			}
+		}
+		if reservedWords[strings.ToUpper(t.text)] {
+			return nil, p.unexpected()
+		}
+		p.pos++
+		if !p.accept("(") {
+			return columnRef{name: t.text}, nil
+		}
+		call := callExpr{name: strings.ToLower(t.text)}
+		if p.accept("*") {
+			call.star = true
+			return call, p.expect(")")
+		}
+		if p.accept(")") {
+			return call, nil
+		}
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return call, p.expect(")")
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02",
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	var err error
+	for _, layout := range timestampLayouts {
+		var ts time.Time
+		if ts, err = time.Parse(layout, s); err == nil {
+			return ts.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -4,19 +4,35 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	writetypes "github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
 )
 
 // Unmarshal decodes data from Timestream query output into a struct or a slice of structs.
 //
+// It also accepts a *map[string]any or a *[]map[string]any, for results that are
+// not known ahead of time. Map values are keyed by column name and typed from the
+// column type: VARCHAR as string, BIGINT and INTEGER as int64, DOUBLE as float64,
+// BOOLEAN as bool, TIMESTAMP and DATE as time.Time, TIME and INTERVAL_DAY_TO_SECOND
+// as time.Duration, ARRAY as []any, ROW as map[string]any, TIMESERIES as
+// []TimeSeriesPoint[any] and NULL as nil. See Rows for typed access to such values.
+//
+// Values are parsed according to the type of their column in the query output, and
+// every field is checked against the type of its column before decoding: BIGINT
+// decodes into integers and floats, DOUBLE into floats, TIMESTAMP and DATE into
+// time.Time, INTERVAL_DAY_TO_SECOND into time.Duration, and any column into a
+// string holding the value as returned by Timestream.
+//
 // The 'v' parameter must be a pointer to a struct or a pointer to a slice of structs.
 // The struct fields should be annotated with 'timestream' tags that specify how to map
-// Timestream column names to struct fields. Supported struct field types are string, int,
-// float64, and time.Time.
+// Timestream column names to struct fields. Supported struct field types are string, bool,
+// every int, uint and float width, and time.Time, as well as pointers to them and sql.Null*-style wrappers such as
+// sql.NullString. Types implementing TimestreamUnmarshaler or encoding.TextUnmarshaler decode
+// themselves. A NULL column leaves a pointer nil and a wrapper invalid, while other
+// fields are left at their zero value.
 //
 // The function supports unmarshalling into either a single struct (if the query output
 // contains a single row of data) or a slice of structs (if multiple rows are present).
@@ -24,6 +40,12 @@ import (
 // `timestream:"name=column_name"` for regular columns or `timestream:"time"` for the
 // special timestamp column.
 //
+// The tags understood by Marshal work too, so that a struct can be written and read
+// back: "timestamp" reads the time column, "measure" the measure_name column, and
+// "dimension" and "attribute" the column named after them. Embedded structs and
+// "inline" fields are walked with their prefix, as Marshal does. A "name" option
+// overrides the column of any field. Unknown options are reported as errors.
+//
 // Example usage:
 //
 //	type MyData struct {
@@ -49,9 +71,14 @@ import (
 //
 // This function will return an error if:
 // - The 'v' parameter is not a pointer.
-// - The 'v' parameter is not a pointer to a struct or a slice of structs.
+// - The 'v' parameter is not a pointer to a struct, a map[string]any or a slice of them.
 // - The length of the slice does not match the number of rows in the query output (when unmarshaling into a slice).
 // - There is a mismatch between the number of columns in the query output and the number of fields in the struct.
+// - A value does not fit the width of its numeric field, e.g. 300 into an uint8.
+//
+// Invalid tags are reported as a *TagError, and fields that cannot hold their column
+// as a *FieldError naming the field and column. Errors met while decoding a row are
+// wrapped in a *RowError holding the index of the row.
 //
 // Note: It's important to ensure that the types of the struct fields are compatible with the data types
 // in the Timestream query output. For example, Timestream timestamps should be mapped to time.Time fields,
@@ -64,14 +91,31 @@ func Unmarshal(queryOutput *timestreamquery.QueryOutput, v any) error {
 
 	lookup := buildLookupTable(queryOutput.ColumnInfo)
 
+	structType := structVal.Type()
+	if structType.Kind() == reflect.Slice {
+		structType = structType.Elem()
+	}
+
+	var fields []boundField
+	if structType.Kind() == reflect.Struct {
+		if err := validateColumnTypes(structType, queryOutput.ColumnInfo, lookup); err != nil {
+			return err
+		}
+		if len(queryOutput.Rows) > 0 {
+			if fields, err = bindColumns(structType, lookup); err != nil {
+				return err
+			}
+		}
+	}
+
 	if structVal.Kind() == reflect.Slice {
 		sliceType := structVal.Type().Elem()
 		resizedSlice := reflect.MakeSlice(structVal.Type(), len(queryOutput.Rows), len(queryOutput.Rows))
 
 		for i, row := range queryOutput.Rows {
 			newStruct := reflect.New(sliceType).Elem()
-			if err := unmarshalRow(row, newStruct, lookup); err != nil {
-				return err
+			if err := unmarshalInto(row, queryOutput.ColumnInfo, newStruct, fields); err != nil {
+				return &RowError{Index: i, Err: err}
 			}
 
 			resizedSlice.Index(i).Set(newStruct)
@@ -79,90 +123,192 @@ func Unmarshal(queryOutput *timestreamquery.QueryOutput, v any) error {
 
 		structVal.Set(resizedSlice)
 	} else if len(queryOutput.Rows) == 1 {
-		if err := unmarshalRow(queryOutput.Rows[0], structVal, lookup); err != nil {
-			return err
+		if err := unmarshalInto(queryOutput.Rows[0], queryOutput.ColumnInfo, structVal, fields); err != nil {
+			return &RowError{Index: 0, Err: err}
 		}
 	}
 
 	return nil
 }
 
-func unmarshalRow(row types.Row, structVal reflect.Value, lookup map[string]int) error {
-	t := structVal.Type()
-	for i := 0; i < structVal.NumField(); i++ {
-		field := t.Field(i)
+// unmarshalInto decodes a row into a struct, through the fields bound to its
+// columns, or into a map[string]any.
+func unmarshalInto(row types.Row, columns []types.ColumnInfo, target reflect.Value, fields []boundField) error {
+	if target.Type() != mapType {
+		return decodeFields(row, columns, target, fields)
+	}
 
-		tag := field.Tag.Get("timestream")
-		if tag == "" || tag == "-" {
-			continue
-		}
+	m, err := decodeMap(row, columns)
+	if err != nil {
+		return err
+	}
 
-		columnName, err := getColumnName(tag)
-		if err != nil {
-			return err
-		}
+	target.Set(reflect.ValueOf(m))
+	return nil
+}
+
+func unmarshalRow(row types.Row, columns []types.ColumnInfo, structVal reflect.Value, lookup map[string]int) error {
+	fields, err := bindColumns(structVal.Type(), lookup)
+	if err != nil {
+		return err
+	}
+	return decodeFields(row, columns, structVal, fields)
+}
+
+// boundField is a struct field along with the position of its column in the
+// query output, resolved once for every row.
+type boundField struct {
+	columnField
+	pos int
+}
 
-		pos, found := lookup[columnName]
+// fieldError reports err for the field of a struct of type root.
+func (f columnField) fieldError(root reflect.Type, err error) error {
+	return &FieldError{
+		Type:   typeName(root),
+		Field:  f.path,
+		Tag:    f.field.Tag.Get("timestream"),
+		Column: f.column,
+		Err:    err,
+	}
+}
+
+// bindColumns resolves the position of the column of every field of struct type t.
+func bindColumns(t reflect.Type, lookup map[string]int) ([]boundField, error) {
+	fields, err := columnFields(t)
+	if err != nil {
+		return nil, err
+	}
+	return bindFields(t, fields, lookup)
+}
+
+// bindFields resolves the position of the column of every field of struct type t.
+func bindFields(t reflect.Type, fields []columnField, lookup map[string]int) ([]boundField, error) {
+	bound := make([]boundField, len(fields))
+	for i, f := range fields {
+		pos, found := lookup[f.column]
 		if !found {
-			return fmt.Errorf("column '%s' not found in Timestream data", columnName)
+			return nil, f.fieldError(t, fmt.Errorf("column '%s' not found in Timestream data", f.column))
 		}
+		bound[i] = boundField{columnField: f, pos: pos}
+	}
+	return bound, nil
+}
 
-		if err := setStructFieldFromRow(row, pos, structVal.Field(i)); err != nil {
-			return err
+func decodeFields(row types.Row, columns []types.ColumnInfo, structVal reflect.Value, fields []boundField) error {
+	for _, f := range fields {
+		// NULL columns leave the struct pointers on the way to their field nil, so
+		// that an inline struct whose columns are all NULL stays missing.
+		if f.pos < len(row.Data) && isNullDatum(row.Data[f.pos]) && !fieldValue(structVal, f.index).IsValid() {
+			continue
+		}
+		if err := setStructFieldFromRow(row, f.pos, columns[f.pos], fieldByIndex(structVal, f.index)); err != nil {
+			return f.fieldError(structVal.Type(), err)
 		}
 	}
 	return nil
 }
 
-func getColumnName(tag string) (string, error) {
-	if tag == "time" || tag == "timestamp" {
-		return tag, nil
+// validateColumnTypes checks that every tagged field of t can hold the values of
+// its column, before any row is decoded.
+func validateColumnTypes(t reflect.Type, columns []types.ColumnInfo, lookup map[string]int) error {
+	fields, err := columnFields(t)
+	if err != nil {
+		return err
 	}
+	return checkFieldTypes(t, fields, columns, lookup)
+}
 
-	tagParts := strings.Split(tag, "=")
-	if len(tagParts) != 2 || tagParts[0] != "name" {
-		return "", fmt.Errorf("invalid tag format")
-	}
+// checkFieldTypes checks that every field of struct type t can hold the values of
+// its column.
+func checkFieldTypes(t reflect.Type, fields []columnField, columns []types.ColumnInfo, lookup map[string]int) error {
+	for _, f := range fields {
+		pos, found := lookup[f.column]
+		if !found {
+			continue
+		}
 
-	return tagParts[1], nil
+		if err := checkColumnType(f.field.Type, columns[pos]); err != nil {
+			return f.fieldError(t, err)
+		}
+	}
+	return nil
 }
 
-func setStructFieldFromRow(row types.Row, pos int, field reflect.Value) error {
+func setStructFieldFromRow(row types.Row, pos int, column types.ColumnInfo, field reflect.Value) error {
 	if pos < 0 || pos >= len(row.Data) {
 		return fmt.Errorf("column position '%d' out of range", pos)
 	}
 
-	data := row.Data[pos].ScalarValue
-	if data == nil {
-		return nil // field remains at its zero value
+	return decodeDatum(field, column, row.Data[pos])
+}
+
+func setFieldValue(field reflect.Value, column types.ColumnInfo, data string) error {
+	if field.Kind() == reflect.Pointer {
+		elem := reflect.New(field.Type().Elem())
+		if err := setFieldValue(elem.Elem(), column, data); err != nil {
+			return err
+		}
+
+		field.Set(elem)
+		return nil
+	}
+
+	if i, ok := nullableValueIndex(field.Type()); ok {
+		if err := setFieldValue(field.Field(i), column, data); err != nil {
+			return err
+		}
+
+		field.FieldByName("Valid").SetBool(true)
+		return nil
+	}
+
+	if custom, err := unmarshalCustom(field, measureValueTypeOf(column), data); custom {
+		return err
 	}
 
-	return setFieldValue(field, *data)
+	if scalarType := scalarTypeOf(column); scalarType != "" {
+		return decodeScalar(field, scalarType, data)
+	}
+	return setFieldValueByKind(field, data)
 }
 
-func setFieldValue(field reflect.Value, data string) error {
+// setFieldValueByKind decodes data according to the kind of the field, for columns
+// without type information.
+func setFieldValueByKind(field reflect.Value, data string) error {
 	switch field.Kind() {
 	case reflect.String:
 		field.SetString(data)
-	case reflect.Int, reflect.Int64:
-		intValue, err := strconv.ParseInt(data, 10, 64)
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(data)
 		if err != nil {
-			return fmt.Errorf("failed to parse int: %w", err)
+			return fmt.Errorf("failed to parse bool: %w", err)
+		}
+
+		field.SetBool(boolValue)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		intValue, err := strconv.ParseInt(data, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", field.Kind(), err)
 		}
 
 		field.SetInt(intValue)
-	case reflect.Float64:
-		floatValue, err := strconv.ParseFloat(data, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		uintValue, err := strconv.ParseUint(data, 10, field.Type().Bits())
 		if err != nil {
-			return fmt.Errorf("failed to parse float64: %w", err)
+			return fmt.Errorf("failed to parse %s: %w", field.Kind(), err)
+		}
+
+		field.SetUint(uintValue)
+	case reflect.Float32, reflect.Float64:
+		floatValue, err := strconv.ParseFloat(data, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", field.Kind(), err)
 		}
 
 		field.SetFloat(floatValue)
 	case reflect.Struct:
-		// Assuming the field is time.Time and the custom format matches your timestamp
-		const customLayout = "2006-01-02 15:04:05.000000000"
-
-		parsedTime, err := time.Parse(customLayout, data)
+		parsedTime, err := time.Parse(timestampLayout, data)
 		if err != nil {
 			return fmt.Errorf("failed to parse time: %w", err)
 		}
@@ -201,19 +347,21 @@ func validateInput(queryOutput *timestreamquery.QueryOutput, v any) (reflect.Val
 }
 
 func validateTargetType(valElem reflect.Value) error {
-	switch valElem.Kind() {
-	case reflect.Slice, reflect.Struct:
+	t := valElem.Type()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct || t == mapType {
 		return nil
-	default:
-		return fmt.Errorf("target must be a pointer to a struct or slice of structs, got %s", valElem.Kind().String())
 	}
+	return fmt.Errorf("target must be a pointer to a struct, a map[string]any or a slice of them, got %s", valElem.Type())
 }
 
 func validateRowCount(valElem reflect.Value, rows []types.Row) error {
 	if valElem.Kind() == reflect.Slice && valElem.Len() > 0 && len(rows) != valElem.Len() {
 		return fmt.Errorf("queryOutput and target slice length mismatch")
 	}
-	if valElem.Kind() == reflect.Struct && len(rows) > 1 {
+	if valElem.Kind() != reflect.Slice && len(rows) > 1 {
 		return fmt.Errorf("expected a slice for a multiple rows QueryResult")
 	}
 	return nil
@@ -228,6 +376,29 @@ func validateRowDataLength(queryOutput *timestreamquery.QueryOutput) error {
 	return nil
 }
 
+// measureValueTypeOf maps the scalar type of a query column to the measure value
+// type it was most likely written as. Columns without a matching measure value
+// type, such as DATE or arrays, map to an empty type.
+func measureValueTypeOf(column types.ColumnInfo) writetypes.MeasureValueType {
+	if column.Type == nil {
+		return ""
+	}
+
+	switch column.Type.ScalarType {
+	case types.ScalarTypeVarchar:
+		return writetypes.MeasureValueTypeVarchar
+	case types.ScalarTypeDouble:
+		return writetypes.MeasureValueTypeDouble
+	case types.ScalarTypeBigint, types.ScalarTypeInteger:
+		return writetypes.MeasureValueTypeBigint
+	case types.ScalarTypeBoolean:
+		return writetypes.MeasureValueTypeBoolean
+	case types.ScalarTypeTimestamp:
+		return writetypes.MeasureValueTypeTimestamp
+	}
+	return ""
+}
+
 func buildLookupTable(columnInfo []types.ColumnInfo) map[string]int {
 	lookup := make(map[string]int)
 	for i, column := range columnInfo {
@@ -1,11 +1,15 @@
 package timestream_test
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"math"
 	"testing"
 	"time"
 
 	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/EvergenEnergy/TimeSchema/pkg/timestreamtest"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
@@ -132,6 +136,409 @@ func TestUnmarshal(t *testing.T) {
 	}
 }
 
+func TestUnmarshalNullable(t *testing.T) {
+	type MyData struct {
+		Timestamp *time.Time      `timestream:"time"`
+		Name      *string         `timestream:"name=dimension_name"`
+		Energy    *float64        `timestream:"name=modelled_generation"`
+		Power     *int            `timestream:"name=actual_pv_power"`
+		Price     sql.NullFloat64 `timestream:"name=price"`
+		Tariff    sql.NullString  `timestream:"name=tariff"`
+	}
+
+	record := &timestreamquery.QueryOutput{
+		ColumnInfo: []types.ColumnInfo{
+			{Type: &types.Type{ScalarType: types.ScalarTypeTimestamp}, Name: aws.String("time")},
+			{Type: &types.Type{ScalarType: types.ScalarTypeVarchar}, Name: aws.String("dimension_name")},
+			{Type: &types.Type{ScalarType: types.ScalarTypeDouble}, Name: aws.String("modelled_generation")},
+			{Type: &types.Type{ScalarType: types.ScalarTypeInteger}, Name: aws.String("actual_pv_power")},
+			{Type: &types.Type{ScalarType: types.ScalarTypeDouble}, Name: aws.String("price")},
+			{Type: &types.Type{ScalarType: types.ScalarTypeVarchar}, Name: aws.String("tariff")},
+		},
+		Rows: []types.Row{{Data: []types.Datum{
+			{ScalarValue: aws.String("2024-01-08 02:32:04.000000000")},
+			{ScalarValue: aws.String("A dimension name")},
+			{ScalarValue: aws.String("0")},
+			{NullValue: aws.Bool(true)},
+			{ScalarValue: aws.String("0.25")},
+			{NullValue: aws.Bool(true)},
+		}}},
+	}
+
+	var got []MyData
+	err := timestream.Unmarshal(record, &got)
+	assert.NoError(t, err)
+
+	want := []MyData{{
+		Timestamp: aws.Time(time.Date(2024, time.January, 8, 2, 32, 4, 0, time.UTC)),
+		Name:      aws.String("A dimension name"),
+		Energy:    aws.Float64(0),
+		Price:     sql.NullFloat64{Float64: 0.25, Valid: true},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unmarshal() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnmarshalCustomTypes(t *testing.T) {
+	type MyData struct {
+		Status testStatus  `timestream:"name=status"`
+		Price  testAmount  `timestream:"name=price"`
+		Target *testAmount `timestream:"name=target"`
+	}
+
+	record := &timestreamquery.QueryOutput{
+		ColumnInfo: []types.ColumnInfo{
+			{Type: &types.Type{ScalarType: types.ScalarTypeVarchar}, Name: aws.String("status")},
+			{Type: &types.Type{ScalarType: types.ScalarTypeDouble}, Name: aws.String("price")},
+			{Type: &types.Type{ScalarType: types.ScalarTypeDouble}, Name: aws.String("target")},
+		},
+		Rows: []types.Row{{Data: []types.Datum{
+			{ScalarValue: aws.String("charging")},
+			{ScalarValue: aws.String("12.34")},
+			{ScalarValue: aws.String("0.50")},
+		}}},
+	}
+
+	var got MyData
+	err := timestream.Unmarshal(record, &got)
+	assert.NoError(t, err)
+	assert.Equal(t, MyData{Status: testStatusCharging, Price: testAmount{cents: 1234}, Target: &testAmount{cents: 50}}, got)
+
+	record.Rows[0].Data[0].ScalarValue = aws.String("unknown")
+	err = timestream.Unmarshal(record, &got)
+	assert.Error(t, err)
+}
+
+func TestUnmarshalNumericWidths(t *testing.T) {
+	type MyData struct {
+		Charging bool    `timestream:"name=charging"`
+		Cycles   uint32  `timestream:"name=cycles"`
+		Offset   int8    `timestream:"name=offset"`
+		Ratio    float32 `timestream:"name=ratio"`
+	}
+
+	newRecord := func(charging, cycles, offset, ratio string) *timestreamquery.QueryOutput {
+		return &timestreamquery.QueryOutput{
+			ColumnInfo: []types.ColumnInfo{
+				{Type: &types.Type{ScalarType: types.ScalarTypeBoolean}, Name: aws.String("charging")},
+				{Type: &types.Type{ScalarType: types.ScalarTypeBigint}, Name: aws.String("cycles")},
+				{Type: &types.Type{ScalarType: types.ScalarTypeBigint}, Name: aws.String("offset")},
+				{Type: &types.Type{ScalarType: types.ScalarTypeDouble}, Name: aws.String("ratio")},
+			},
+			Rows: []types.Row{{Data: []types.Datum{
+				{ScalarValue: aws.String(charging)},
+				{ScalarValue: aws.String(cycles)},
+				{ScalarValue: aws.String(offset)},
+				{ScalarValue: aws.String(ratio)},
+			}}},
+		}
+	}
+
+	var got MyData
+	err := timestream.Unmarshal(newRecord("true", "4294967295", "-128", "0.5"), &got)
+	assert.NoError(t, err)
+	assert.Equal(t, MyData{Charging: true, Cycles: math.MaxUint32, Offset: math.MinInt8, Ratio: 0.5}, got)
+
+	overflows := map[string]*timestreamquery.QueryOutput{
+		"bool":     newRecord("maybe", "1", "1", "1"),
+		"uint32":   newRecord("true", "4294967296", "1", "1"),
+		"negative": newRecord("true", "-1", "1", "1"),
+		"int8":     newRecord("true", "1", "128", "1"),
+		"float32":  newRecord("true", "1", "1", "1e39"),
+	}
+	for name, record := range overflows {
+		t.Run(name, func(t *testing.T) {
+			err := timestream.Unmarshal(record, &MyData{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestUnmarshalColumnTypes(t *testing.T) {
+	newRecord := func(scalarType types.ScalarType, value string) *timestreamquery.QueryOutput {
+		return &timestreamquery.QueryOutput{
+			ColumnInfo: []types.ColumnInfo{{Type: &types.Type{ScalarType: scalarType}, Name: aws.String("v")}},
+			Rows:       []types.Row{{Data: []types.Datum{{ScalarValue: aws.String(value)}}}},
+		}
+	}
+
+	type String struct {
+		V string `timestream:"name=v"`
+	}
+	type Float struct {
+		V float64 `timestream:"name=v"`
+	}
+	type Int struct {
+		V int16 `timestream:"name=v"`
+	}
+	type Time struct {
+		V time.Time `timestream:"name=v"`
+	}
+	type Duration struct {
+		V *time.Duration `timestream:"name=v"`
+	}
+
+	hour := time.Hour + 30*time.Second
+	tests := []struct {
+		name       string
+		scalarType types.ScalarType
+		value      string
+		target     any
+		want       any
+	}{
+		{"BIGINT into float", types.ScalarTypeBigint, "42", &Float{}, &Float{V: 42}},
+		{"TIMESTAMP into string", types.ScalarTypeTimestamp, "2024-01-08 02:32:04.000000000", &String{}, &String{V: "2024-01-08 02:32:04.000000000"}},
+		{"DOUBLE into string", types.ScalarTypeDouble, "1.5", &String{}, &String{V: "1.5"}},
+		{"TIMESTAMP with short fraction", types.ScalarTypeTimestamp, "2024-01-08 02:32:04.5", &Time{}, &Time{V: time.Date(2024, 1, 8, 2, 32, 4, 5e8, time.UTC)}},
+		{"DATE", types.ScalarTypeDate, "2024-01-08", &Time{}, &Time{V: time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)}},
+		{"TIME into time", types.ScalarTypeTime, "01:00:30.000000000", &Time{}, &Time{V: time.Date(0, 1, 1, 1, 0, 30, 0, time.UTC)}},
+		{"TIME into duration", types.ScalarTypeTime, "01:00:30.000000000", &Duration{}, &Duration{V: &hour}},
+		{"INTERVAL_DAY_TO_SECOND", types.ScalarTypeIntervalDayToSecond, "0 01:00:30.000000000", &Duration{}, &Duration{V: &hour}},
+		{"INTERVAL_YEAR_TO_MONTH", types.ScalarTypeIntervalYearToMonth, "-1-2", &Int{}, &Int{V: -14}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := timestream.Unmarshal(newRecord(tt.scalarType, tt.value), tt.target)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, tt.target)
+		})
+	}
+
+	incompatible := []struct {
+		name       string
+		scalarType types.ScalarType
+		value      string
+		target     any
+	}{
+		{"DOUBLE into int", types.ScalarTypeDouble, "1.5", &Int{}},
+		{"VARCHAR into float", types.ScalarTypeVarchar, "1.5", &Float{}},
+		{"TIMESTAMP into float", types.ScalarTypeTimestamp, "2024-01-08 02:32:04.000000000", &Float{}},
+		{"BIGINT into time", types.ScalarTypeBigint, "1704680000", &Time{}},
+		{"BIGINT into duration", types.ScalarTypeBigint, "1", &Duration{}},
+		{"BOOLEAN into int", types.ScalarTypeBoolean, "true", &Int{}},
+		{"unsupported type", types.ScalarType("JSON"), "{}", &Int{}},
+		{"malformed interval", types.ScalarTypeIntervalDayToSecond, "01:00:30", &Duration{}},
+	}
+	for _, tt := range incompatible {
+		t.Run(tt.name, func(t *testing.T) {
+			err := timestream.Unmarshal(newRecord(tt.scalarType, tt.value), tt.target)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("incompatible fields are reported without rows", func(t *testing.T) {
+		record := newRecord(types.ScalarTypeDouble, "1.5")
+		record.Rows = nil
+		err := timestream.Unmarshal(record, &[]Int{})
+		assert.ErrorContains(t, err, "cannot decode DOUBLE column into int16")
+	})
+}
+
+func TestUnmarshalComplexTypes(t *testing.T) {
+	scalar := func(scalarType types.ScalarType) *types.Type {
+		return &types.Type{ScalarType: scalarType}
+	}
+	point := func(ts string, value types.Datum) types.TimeSeriesDataPoint {
+		return types.TimeSeriesDataPoint{Time: aws.String(ts), Value: &value}
+	}
+	value := func(v string) types.Datum {
+		return types.Datum{ScalarValue: aws.String(v)}
+	}
+
+	powerRow := []types.ColumnInfo{
+		{Name: aws.String("power"), Type: scalar(types.ScalarTypeDouble)},
+		{Name: aws.String("site"), Type: scalar(types.ScalarTypeVarchar)},
+	}
+	record := &timestreamquery.QueryOutput{
+		ColumnInfo: []types.ColumnInfo{
+			{Name: aws.String("sites"), Type: &types.Type{ArrayColumnInfo: &types.ColumnInfo{Type: scalar(types.ScalarTypeVarchar)}}},
+			{Name: aws.String("latest"), Type: &types.Type{RowColumnInfo: powerRow}},
+			{Name: aws.String("series"), Type: &types.Type{TimeSeriesMeasureValueColumnInfo: &types.ColumnInfo{Type: scalar(types.ScalarTypeDouble)}}},
+			{Name: aws.String("multi"), Type: &types.Type{TimeSeriesMeasureValueColumnInfo: &types.ColumnInfo{Type: &types.Type{RowColumnInfo: powerRow}}}},
+			{Name: aws.String("missing"), Type: &types.Type{ArrayColumnInfo: &types.ColumnInfo{Type: scalar(types.ScalarTypeBigint)}}},
+		},
+		Rows: []types.Row{{Data: []types.Datum{
+			{ArrayValue: []types.Datum{value("north"), {NullValue: aws.Bool(true)}}},
+			{RowValue: &types.Row{Data: []types.Datum{value("1.5"), value("north")}}},
+			{TimeSeriesValue: []types.TimeSeriesDataPoint{
+				point("2024-01-08 02:00:00.000000000", value("1.5")),
+				point("2024-01-08 02:01:00.000000000", value("2.5")),
+			}},
+			{TimeSeriesValue: []types.TimeSeriesDataPoint{
+				point("2024-01-08 02:00:00.000000000", types.Datum{RowValue: &types.Row{Data: []types.Datum{value("3"), value("south")}}}),
+			}},
+			{NullValue: aws.Bool(true)},
+		}}},
+	}
+
+	type Power struct {
+		Power float64 `timestream:"name=power"`
+		Site  string  `timestream:"name=site"`
+	}
+	type PowerPoint struct {
+		Time  time.Time `timestream:"time"`
+		Power float64   `timestream:"name=power"`
+		Site  string    `timestream:"name=site"`
+	}
+	type MyData struct {
+		Sites   []*string                             `timestream:"name=sites"`
+		Latest  *Power                                `timestream:"name=latest"`
+		Series  []timestream.TimeSeriesPoint[float64] `timestream:"name=series"`
+		Multi   []PowerPoint                          `timestream:"name=multi"`
+		Missing []int64                               `timestream:"name=missing"`
+	}
+
+	var got MyData
+	err := timestream.Unmarshal(record, &got)
+	assert.NoError(t, err)
+	assert.Equal(t, MyData{
+		Sites:  []*string{aws.String("north"), nil},
+		Latest: &Power{Power: 1.5, Site: "north"},
+		Series: []timestream.TimeSeriesPoint[float64]{
+			{Time: time.Date(2024, 1, 8, 2, 0, 0, 0, time.UTC), Value: 1.5},
+			{Time: time.Date(2024, 1, 8, 2, 1, 0, 0, time.UTC), Value: 2.5},
+		},
+		Multi: []PowerPoint{{Time: time.Date(2024, 1, 8, 2, 0, 0, 0, time.UTC), Power: 3, Site: "south"}},
+	}, got)
+
+	var rows []struct {
+		Latest timestream.TimeSeriesPoint[Power] `timestream:"name=latest"`
+	}
+	err = timestream.Unmarshal(record, &rows)
+	assert.Error(t, err, "ROW fields are matched by name")
+
+	mismatches := map[string]any{
+		"array into string": &struct {
+			V string `timestream:"name=sites"`
+		}{},
+		"array of ints": &struct {
+			V []int `timestream:"name=sites"`
+		}{},
+		"row into slice": &struct {
+			V []Power `timestream:"name=latest"`
+		}{},
+		"time series into struct": &struct {
+			V Power `timestream:"name=series"`
+		}{},
+		"time series of numbers": &struct {
+			V []float64 `timestream:"name=series"`
+		}{},
+		"time series of booleans": &struct {
+			V []timestream.TimeSeriesPoint[bool] `timestream:"name=series"`
+		}{},
+	}
+	for name, target := range mismatches {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, timestream.Unmarshal(record, target))
+		})
+	}
+}
+
+func TestUnmarshalLeavesNullInlinePointersNil(t *testing.T) {
+	type Battery struct {
+		Serial string  `timestream:"dimension,name=serial"`
+		Power  float64 `timestream:"attribute,name=power"`
+	}
+	type Reading struct {
+		Site    string   `timestream:"dimension,name=site"`
+		Battery *Battery `timestream:"inline,prefix=battery_"`
+	}
+
+	null := types.Datum{NullValue: aws.Bool(true)}
+	output := &timestreamquery.QueryOutput{
+		ColumnInfo: []types.ColumnInfo{
+			{Name: aws.String("site"), Type: &types.Type{ScalarType: types.ScalarTypeVarchar}},
+			{Name: aws.String("battery_serial"), Type: &types.Type{ScalarType: types.ScalarTypeVarchar}},
+			{Name: aws.String("battery_power"), Type: &types.Type{ScalarType: types.ScalarTypeDouble}},
+		},
+		Rows: []types.Row{
+			{Data: []types.Datum{{ScalarValue: aws.String("site-1")}, null, null}},
+			{Data: []types.Datum{{ScalarValue: aws.String("site-2")}, {ScalarValue: aws.String("B-1")}, {ScalarValue: aws.String("1.5")}}},
+			{Data: []types.Datum{{ScalarValue: aws.String("site-3")}, null, {ScalarValue: aws.String("2.5")}}},
+		},
+	}
+
+	var got []Reading
+	assert.NoError(t, timestream.Unmarshal(output, &got))
+	assert.Equal(t, []Reading{
+		{Site: "site-1"},
+		{Site: "site-2", Battery: &Battery{Serial: "B-1", Power: 1.5}},
+		{Site: "site-3", Battery: &Battery{Power: 2.5}},
+	}, got)
+}
+
+func TestUnmarshalMarshalTags(t *testing.T) {
+	type Header struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+	}
+	type Battery struct {
+		Serial string  `timestream:"dimension,name=serial"`
+		Power  float64 `timestream:"attribute,name=power"`
+	}
+	type Reading struct {
+		Header
+		Site     string  `timestream:"dimension,name=site"`
+		Charging bool    `timestream:"attribute"`
+		Battery  Battery `timestream:"inline,prefix=battery_"`
+	}
+
+	emulator := timestreamtest.NewEmulator()
+	ctx := context.Background()
+	setupEmulator(t, emulator)
+
+	in := Reading{
+		Header:   Header{Timestamp: now.Truncate(time.Millisecond).UTC(), MeasureName: "metrics"},
+		Site:     "site-1",
+		Charging: true,
+		Battery:  Battery{Serial: "B-1", Power: 1.5},
+	}
+	w := timestream.NewWriter(emulator, "db")
+	assert.NoError(t, w.Write(ctx, "readings", []Reading{in}))
+	assert.NoError(t, w.Close(ctx))
+
+	out, err := emulator.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String(`SELECT * FROM "db"."readings"`)})
+	assert.NoError(t, err)
+
+	var got Reading
+	assert.NoError(t, timestream.Unmarshal(out, &got))
+	assert.Equal(t, in, got)
+
+	t.Run("explicit names override the time and measure_name columns", func(t *testing.T) {
+		out, err := emulator.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String(
+			`SELECT time AS ts, measure_name AS metric, site FROM "db"."readings"`,
+		)})
+		assert.NoError(t, err)
+
+		var got struct {
+			Timestamp   time.Time `timestream:"timestamp,name=ts"`
+			MeasureName string    `timestream:"measure,name=metric"`
+			Site        string    `timestream:"name=site"`
+		}
+		assert.NoError(t, timestream.Unmarshal(out, &got))
+		assert.Equal(t, in.Timestamp, got.Timestamp)
+		assert.Equal(t, "metrics", got.MeasureName)
+		assert.Equal(t, "site-1", got.Site)
+	})
+
+	t.Run("rejects invalid tags", func(t *testing.T) {
+		for _, target := range []any{
+			&struct {
+				Site string `timestream:"dimension,nmae=site"`
+			}{},
+			&struct {
+				Timestamp time.Time `timestream:"timestamp,unit=days"`
+			}{},
+			&struct {
+				Site string `timestream:"omitempty"`
+			}{},
+		} {
+			assert.Error(t, timestream.Unmarshal(out, target), "%T", target)
+		}
+	})
+}
+
 func TestUnmarshalUnhappyPath(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -259,3 +666,51 @@ func TestUnmarshalUnhappyPath(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkUnmarshal(b *testing.B) {
+	type Reading struct {
+		Timestamp   time.Time `timestream:"timestamp"`
+		MeasureName string    `timestream:"measure"`
+		Site        string    `timestream:"dimension,name=site"`
+		Power       float64   `timestream:"attribute,name=power"`
+		Cycles      int64     `timestream:"attribute,name=cycles"`
+	}
+
+	output := &timestreamquery.QueryOutput{
+		ColumnInfo: []types.ColumnInfo{
+			{Name: aws.String("time"), Type: &types.Type{ScalarType: types.ScalarTypeTimestamp}},
+			{Name: aws.String("measure_name"), Type: &types.Type{ScalarType: types.ScalarTypeVarchar}},
+			{Name: aws.String("site"), Type: &types.Type{ScalarType: types.ScalarTypeVarchar}},
+			{Name: aws.String("power"), Type: &types.Type{ScalarType: types.ScalarTypeDouble}},
+			{Name: aws.String("cycles"), Type: &types.Type{ScalarType: types.ScalarTypeBigint}},
+		},
+	}
+	for i := 0; i < 10000; i++ {
+		output.Rows = append(output.Rows, types.Row{Data: []types.Datum{
+			{ScalarValue: aws.String("2024-01-08 02:32:04.000000000")},
+			{ScalarValue: aws.String("metrics")},
+			{ScalarValue: aws.String(fmt.Sprintf("site-%d", i%10))},
+			{ScalarValue: aws.String(fmt.Sprintf("%d.5", i))},
+			{ScalarValue: aws.String(fmt.Sprintf("%d", i))},
+		}})
+	}
+
+	for _, n := range []int{1, 10000} {
+		page := &timestreamquery.QueryOutput{ColumnInfo: output.ColumnInfo, Rows: output.Rows[:n]}
+		for _, cached := range []bool{true, false} {
+			b.Run(fmt.Sprintf("rows=%d/cached=%t", n, cached), func(b *testing.B) {
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if !cached {
+						timestream.ResetTypeCaches()
+					}
+					var readings []Reading
+					if err := timestream.Unmarshal(page, &readings); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
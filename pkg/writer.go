@@ -0,0 +1,429 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+)
+
+// maxRecordsPerWrite is the maximum number of records Timestream accepts in a
+// single WriteRecords request.
+const maxRecordsPerWrite = 100
+
+// WriterOption configures a Writer.
+type WriterOption func(*Writer)
+
+// WithBatchSize sets the number of records buffered per table before they are
+// written. It is capped at the Timestream limit of 100 records per request.
+func WithBatchSize(size int) WriterOption {
+	return func(w *Writer) {
+		w.batchSize = min(max(size, 1), maxRecordsPerWrite)
+	}
+}
+
+// WithFlushInterval makes the Writer flush every buffered record at the given
+// interval, so that records are not held back when traffic is low.
+func WithFlushInterval(interval time.Duration) WriterOption {
+	return func(w *Writer) {
+		w.interval = interval
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry throttled requests, server errors
+// and rejected records. It defaults to DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) WriterOption {
+	return func(w *Writer) {
+		w.retry = policy
+	}
+}
+
+// WithRejectionPolicy sets the policy choosing what to do with each record rejected
+// by Timestream. Without it, every rejection is reported through the returned error.
+func WithRejectionPolicy(policy RejectionPolicy) WriterOption {
+	return func(w *Writer) {
+		w.rejectionPolicy = policy
+	}
+}
+
+// WithDeadLetter sets the handler receiving the records the RejectionPolicy sent
+// to the dead letter. Without it, those records are reported through the returned error.
+func WithDeadLetter(handler DeadLetterHandler) WriterOption {
+	return func(w *Writer) {
+		w.deadLetter = handler
+	}
+}
+
+// WithMarshalOptions sets the options used to marshal the structs passed to Write.
+func WithMarshalOptions(opts ...MarshalOption) WriterOption {
+	return func(w *Writer) {
+		w.marshalOpts = opts
+	}
+}
+
+// Writer buffers records per table and writes them to a Timestream database in
+// WriteRecords requests of up to 100 records. Dimensions, the measure name, the
+// measure value type and the time unit shared by every record of a request are
+// moved into its CommonAttributes.
+//
+// Throttled requests and server errors are retried following the RetryPolicy.
+// Records rejected by Timestream are mapped back to the Go value they were
+// marshalled from, and handled according to the RejectionPolicy. Rejections that
+// are not dropped or dead-lettered are returned as a *RejectedRecordsError, or a
+// *VersionConflictError for version conflicts.
+//
+// A Writer is safe for concurrent use. Close must be called once done with it to
+// write the remaining records and stop the interval flushes.
+//
+// Example usage:
+//
+//	w := NewWriter(client, "my_database", WithFlushInterval(5*time.Second))
+//	defer w.Close(ctx)
+//
+//	if err := w.Write(ctx, "my_table", readings); err != nil {
+//	    // handle error
+//	}
+type Writer struct {
+	client          WriteRecordsAPI
+	database        string
+	batchSize       int
+	interval        time.Duration
+	marshalOpts     []MarshalOption
+	retry           RetryPolicy
+	rejectionPolicy RejectionPolicy
+	deadLetter      DeadLetterHandler
+
+	mu      sync.Mutex
+	pending map[string][]pendingRecord
+	err     error
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewWriter returns a Writer sending records to the given database through client.
+func NewWriter(client WriteRecordsAPI, database string, opts ...WriterOption) *Writer {
+	w := &Writer{
+		client:    client,
+		database:  database,
+		batchSize: maxRecordsPerWrite,
+		retry:     DefaultRetryPolicy,
+		pending:   make(map[string][]pendingRecord),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.interval > 0 {
+		w.wg.Add(1)
+		go w.flushPeriodically()
+	}
+	return w
+}
+
+// pendingRecord is a buffered record along with the value it was marshalled from.
+type pendingRecord struct {
+	record types.Record
+	value  any
+}
+
+// Write buffers v for the given table. v may be a struct, a slice of structs, which
+// are marshalled with Marshal, a types.Record or a []types.Record. Full batches are
+// written before Write returns.
+func (w *Writer) Write(ctx context.Context, table string, v any) error {
+	records, err := w.toPending(v)
+	if err != nil {
+		return err
+	}
+
+	var batches [][]pendingRecord
+
+	w.mu.Lock()
+	pending := append(w.pending[table], records...)
+	for len(pending) >= w.batchSize {
+		batches = append(batches, pending[:w.batchSize:w.batchSize])
+		pending = pending[w.batchSize:]
+	}
+	w.pending[table] = pending
+	w.mu.Unlock()
+
+	var errs error
+	for _, batch := range batches {
+		errs = errors.Join(errs, w.send(ctx, table, batch))
+	}
+	return errs
+}
+
+func (w *Writer) toPending(v any) ([]pendingRecord, error) {
+	switch r := v.(type) {
+	case types.Record:
+		return []pendingRecord{{record: r, value: r}}, nil
+	case []types.Record:
+		records := make([]pendingRecord, 0, len(r))
+		for _, record := range r {
+			records = append(records, pendingRecord{record: record, value: record})
+		}
+		return records, nil
+	}
+
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Slice {
+		return w.marshalPending(v)
+	}
+
+	var records []pendingRecord
+	var errs error
+	for i := 0; i < val.Len(); i++ {
+		marshalled, err := w.marshalPending(val.Index(i).Interface())
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		records = append(records, marshalled...)
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return records, nil
+}
+
+func (w *Writer) marshalPending(v any) ([]pendingRecord, error) {
+	records, err := Marshal(v, w.marshalOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]pendingRecord, 0, len(records))
+	for _, record := range records {
+		pending = append(pending, pendingRecord{record: record, value: v})
+	}
+	return pending, nil
+}
+
+// Flush writes every buffered record. It also returns the errors of the interval
+// flushes that happened since the last call to Flush.
+func (w *Writer) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	pending := w.pending
+	errs := w.err
+	w.pending = make(map[string][]pendingRecord)
+	w.err = nil
+	w.mu.Unlock()
+
+	for table, records := range pending {
+		for len(records) > 0 {
+			n := min(len(records), w.batchSize)
+			errs = errors.Join(errs, w.send(ctx, table, records[:n]))
+			records = records[n:]
+		}
+	}
+	return errs
+}
+
+// Close stops the interval flushes and writes every buffered record.
+func (w *Writer) Close(ctx context.Context) error {
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+	w.wg.Wait()
+	return w.Flush(ctx)
+}
+
+func (w *Writer) flushPeriodically() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if err := w.Flush(context.Background()); err != nil {
+				w.mu.Lock()
+				w.err = errors.Join(w.err, err)
+				w.mu.Unlock()
+			}
+		}
+	}
+}
+
+// send writes a batch, retrying it as a whole after throttling and server errors,
+// and retrying the rejected records the rejection policy asks for.
+func (w *Writer) send(ctx context.Context, table string, batch []pendingRecord) error {
+	var errs error
+	var retried []Rejection
+
+	for attempt := 1; ; attempt++ {
+		records := make([]types.Record, len(batch))
+		for i, p := range batch {
+			records[i] = p.record
+		}
+
+		common, records := factorCommonAttributes(records)
+		_, err := w.client.WriteRecords(ctx, &timestreamwrite.WriteRecordsInput{
+			DatabaseName:     aws.String(w.database),
+			TableName:        aws.String(table),
+			CommonAttributes: common,
+			Records:          records,
+		})
+
+		var rejected *types.RejectedRecordsException
+		switch {
+		case err == nil:
+			return errs
+		case errors.As(err, &rejected):
+			var rejErr error
+			batch, retried, rejErr = w.handleRejections(ctx, table, batch, rejected.RejectedRecords)
+			errs = errors.Join(errs, rejErr)
+			if len(batch) == 0 {
+				return errs
+			}
+		case !isRetryable(err):
+			return errors.Join(errs, fmt.Errorf("failed to write %d records to %s: %w", len(records), table, err))
+		}
+
+		if attempt >= w.retry.MaxAttempts {
+			if rejected == nil {
+				errs = errors.Join(errs, fmt.Errorf("failed to write %d records to %s after %d attempts: %w", len(records), table, attempt, err))
+			}
+			// Records retried after a rejection are still reported as rejected when
+			// the last attempt was throttled instead.
+			return errors.Join(errs, rejectionsError(table, retried))
+		}
+		if err := w.retry.wait(ctx, attempt); err != nil {
+			return errors.Join(errs, fmt.Errorf("failed to write %d records to %s: %w", len(records), table, err))
+		}
+	}
+}
+
+// handleRejections applies the rejection policy to the rejected records of batch.
+// It returns the records to retry along with their rejections, and the error
+// reporting the failed ones.
+func (w *Writer) handleRejections(ctx context.Context, table string, batch []pendingRecord, rejected []types.RejectedRecord) ([]pendingRecord, []Rejection, error) {
+	var retry []pendingRecord
+	var retried, failed, deadLetters []Rejection
+
+	for _, r := range rejected {
+		if r.RecordIndex < 0 || int(r.RecordIndex) >= len(batch) {
+			return nil, nil, fmt.Errorf("rejected record index %d out of range for %d records", r.RecordIndex, len(batch))
+		}
+
+		p := batch[r.RecordIndex]
+		rejection := Rejection{Value: p.value, Record: p.record, Reason: aws.ToString(r.Reason), ExistingVersion: r.ExistingVersion}
+
+		action := RejectionFail
+		if w.rejectionPolicy != nil {
+			action = w.rejectionPolicy(rejection)
+		}
+		if action == RejectionDeadLetter && w.deadLetter == nil {
+			action = RejectionFail
+		}
+
+		switch action {
+		case RejectionRetry:
+			retry = append(retry, p)
+			retried = append(retried, rejection)
+		case RejectionDrop:
+		case RejectionDeadLetter:
+			deadLetters = append(deadLetters, rejection)
+		default:
+			failed = append(failed, rejection)
+		}
+	}
+
+	if len(deadLetters) > 0 {
+		w.deadLetter(ctx, deadLetters)
+	}
+	return retry, retried, rejectionsError(table, failed)
+}
+
+// factorCommonAttributes moves the dimensions, measure name, measure value type and
+// time unit shared by every record into a common record, and returns it along with
+// copies of the records stripped of those attributes. It returns a nil common
+// record when nothing is shared.
+func factorCommonAttributes(records []types.Record) (*types.Record, []types.Record) {
+	if len(records) < 2 {
+		return nil, records
+	}
+
+	var common types.Record
+	first := records[0]
+
+	for _, d := range first.Dimensions {
+		if allRecords(records, func(r types.Record) bool { return hasDimension(r, d) }) {
+			common.Dimensions = append(common.Dimensions, d)
+		}
+	}
+	if first.MeasureName != nil && allRecords(records, func(r types.Record) bool {
+		return r.MeasureName != nil && *r.MeasureName == *first.MeasureName
+	}) {
+		common.MeasureName = first.MeasureName
+	}
+	if first.MeasureValueType != "" && allRecords(records, func(r types.Record) bool {
+		return r.MeasureValueType == first.MeasureValueType
+	}) {
+		common.MeasureValueType = first.MeasureValueType
+	}
+	if first.TimeUnit != "" && allRecords(records, func(r types.Record) bool {
+		return r.TimeUnit == first.TimeUnit
+	}) {
+		common.TimeUnit = first.TimeUnit
+	}
+
+	if len(common.Dimensions) == 0 && common.MeasureName == nil && common.MeasureValueType == "" && common.TimeUnit == "" {
+		return nil, records
+	}
+
+	stripped := make([]types.Record, len(records))
+	for i, r := range records {
+		if common.MeasureName != nil {
+			r.MeasureName = nil
+		}
+		if common.MeasureValueType != "" {
+			r.MeasureValueType = ""
+		}
+		if common.TimeUnit != "" {
+			r.TimeUnit = ""
+		}
+
+		var dimensions []types.Dimension
+		for _, d := range r.Dimensions {
+			if !hasDimension(common, d) {
+				dimensions = append(dimensions, d)
+			}
+		}
+		r.Dimensions = dimensions
+		stripped[i] = r
+	}
+	return &common, stripped
+}
+
+func allRecords(records []types.Record, f func(types.Record) bool) bool {
+	for _, r := range records {
+		if !f(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasDimension(r types.Record, d types.Dimension) bool {
+	for _, rd := range r.Dimensions {
+		if aws.ToString(rd.Name) == aws.ToString(d.Name) && aws.ToString(rd.Value) == aws.ToString(d.Value) &&
+			rd.DimensionValueType == d.DimensionValueType {
+			return true
+		}
+	}
+	return false
+}
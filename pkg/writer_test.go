@@ -0,0 +1,277 @@
+package timestream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	timestream "github.com/EvergenEnergy/TimeSchema/pkg"
+	"github.com/EvergenEnergy/TimeSchema/pkg/timestreamtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/assert"
+)
+
+type writerReading struct {
+	Timestamp   time.Time `timestream:"timestamp"`
+	MeasureName string    `timestream:"measure"`
+	Site        string    `timestream:"dimension,name=site"`
+	Device      string    `timestream:"dimension,name=device"`
+	Power       float64   `timestream:"attribute,name=power"`
+}
+
+func newWriterReadings(n int) []writerReading {
+	readings := make([]writerReading, n)
+	for i := range readings {
+		readings[i] = writerReading{
+			Timestamp:   now.Add(time.Duration(i) * time.Second),
+			MeasureName: "metrics",
+			Site:        "site-1",
+			Device:      fmt.Sprintf("device-%d", i%2),
+			Power:       float64(i),
+		}
+	}
+	return readings
+}
+
+func TestWriterBatchesBySize(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	w := timestream.NewWriter(client, "database")
+	ctx := context.Background()
+
+	err := w.Write(ctx, "table", newWriterReadings(250))
+	assert.NoError(t, err)
+	assert.Len(t, client.WriteRequests(), 2, "full batches are written right away")
+
+	err = w.Close(ctx)
+	assert.NoError(t, err)
+
+	requests := client.WriteRequests()
+	assert.Len(t, requests, 3)
+	for i, want := range []int{100, 100, 50} {
+		assert.Equal(t, "database", *requests[i].DatabaseName)
+		assert.Equal(t, "table", *requests[i].TableName)
+		assert.Len(t, requests[i].Records, want)
+	}
+}
+
+func TestWriterFactorsCommonAttributes(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	w := timestream.NewWriter(client, "database", timestream.WithMarshalOptions(timestream.WithTimeUnit("s")))
+	ctx := context.Background()
+
+	err := w.Write(ctx, "table", newWriterReadings(2))
+	assert.NoError(t, err)
+	err = w.Flush(ctx)
+	assert.NoError(t, err)
+
+	requests := client.WriteRequests()
+	assert.Len(t, requests, 1)
+
+	wantCommon := &types.Record{
+		Dimensions:       []types.Dimension{{Name: aws.String("site"), Value: aws.String("site-1")}},
+		MeasureName:      aws.String("metrics"),
+		MeasureValueType: types.MeasureValueTypeMulti,
+		TimeUnit:         types.TimeUnitSeconds,
+	}
+	wantRecords := []types.Record{
+		{
+			Time:          aws.String(fmt.Sprintf("%d", now.Unix())),
+			Dimensions:    []types.Dimension{{Name: aws.String("device"), Value: aws.String("device-0")}},
+			MeasureValues: []types.MeasureValue{{Name: aws.String("power"), Value: aws.String("0"), Type: types.MeasureValueTypeDouble}},
+		},
+		{
+			Time:          aws.String(fmt.Sprintf("%d", now.Add(time.Second).Unix())),
+			Dimensions:    []types.Dimension{{Name: aws.String("device"), Value: aws.String("device-1")}},
+			MeasureValues: []types.MeasureValue{{Name: aws.String("power"), Value: aws.String("1"), Type: types.MeasureValueTypeDouble}},
+		},
+	}
+	opts := cmpopts.IgnoreUnexported(types.Record{}, types.Dimension{}, types.MeasureValue{})
+	if diff := cmp.Diff(wantCommon, requests[0].CommonAttributes, opts); diff != "" {
+		t.Errorf("CommonAttributes mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantRecords, requests[0].Records, opts); diff != "" {
+		t.Errorf("Records mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriterBatchesByTable(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	w := timestream.NewWriter(client, "database", timestream.WithBatchSize(10))
+	ctx := context.Background()
+
+	records, err := timestream.Marshal(newWriterReadings(15))
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Write(ctx, "table_a", records))
+	assert.NoError(t, w.Write(ctx, "table_b", records[0]))
+	assert.NoError(t, w.Close(ctx))
+
+	counts := make(map[string][]int)
+	for _, r := range client.WriteRequests() {
+		counts[*r.TableName] = append(counts[*r.TableName], len(r.Records))
+	}
+	assert.Equal(t, map[string][]int{"table_a": {10, 5}, "table_b": {1}}, counts)
+}
+
+func TestWriterFlushesOnInterval(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	w := timestream.NewWriter(client, "database", timestream.WithFlushInterval(10*time.Millisecond))
+	ctx := context.Background()
+
+	err := w.Write(ctx, "table", newWriterReadings(3))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return len(client.WriteRequests()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.NoError(t, w.Close(ctx))
+	assert.Len(t, client.WriteRequests(), 1)
+}
+
+func TestWriterReturnsErrors(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	client.FailWith(errors.New("boom"))
+	w := timestream.NewWriter(client, "database")
+	ctx := context.Background()
+
+	err := w.Write(ctx, "table", struct{ NotTagged string }{})
+	assert.Error(t, err)
+
+	err = w.Write(ctx, "table", newWriterReadings(1))
+	assert.NoError(t, err)
+	err = w.Close(ctx)
+	assert.ErrorContains(t, err, "boom")
+}
+
+var fastRetries = timestream.WithRetryPolicy(timestream.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+func TestWriterRetriesThrottlingAndServerErrors(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	client.FailWith(
+		&types.ThrottlingException{Message: aws.String("slow down")},
+		&types.InternalServerException{Message: aws.String("oops")},
+	)
+	w := timestream.NewWriter(client, "database", fastRetries)
+	ctx := context.Background()
+
+	assert.NoError(t, w.Write(ctx, "table", newWriterReadings(3)))
+	assert.NoError(t, w.Close(ctx))
+	assert.Len(t, client.WriteRequests(), 3)
+
+	throttled := &types.ThrottlingException{Message: aws.String("slow down")}
+	client = timestreamtest.NewFakeWriteClient()
+	client.FailWith(throttled, throttled, throttled)
+	w = timestream.NewWriter(client, "database", fastRetries)
+	assert.NoError(t, w.Write(ctx, "table", newWriterReadings(3)))
+
+	var throttling *types.ThrottlingException
+	assert.ErrorAs(t, w.Close(ctx), &throttling)
+	assert.Len(t, client.WriteRequests(), 3, "gives up after MaxAttempts")
+
+	client = timestreamtest.NewFakeWriteClient()
+	client.FailWith(&types.ValidationException{Message: aws.String("bad")})
+	w = timestream.NewWriter(client, "database", fastRetries)
+	assert.NoError(t, w.Write(ctx, "table", newWriterReadings(3)))
+	assert.Error(t, w.Close(ctx))
+	assert.Len(t, client.WriteRequests(), 1, "validation errors are not retried")
+}
+
+func TestWriterReportsRejectedRecords(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	client.FailWith(&types.RejectedRecordsException{RejectedRecords: []types.RejectedRecord{
+		{RecordIndex: 0, Reason: aws.String("Record version 1 is lower than the existing version 3"), ExistingVersion: aws.Int64(3)},
+		{RecordIndex: 2, Reason: aws.String("Record timestamp is outside the memory store retention period")},
+	}})
+	w := timestream.NewWriter(client, "database", fastRetries)
+	ctx := context.Background()
+
+	readings := newWriterReadings(3)
+	assert.NoError(t, w.Write(ctx, "table", readings))
+	err := w.Close(ctx)
+
+	var conflict *timestream.VersionConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		assert.Equal(t, []int64{3}, conflict.ExistingVersions())
+		assert.Equal(t, readings[0], conflict.Rejections[0].Value)
+	}
+
+	var rejected *timestream.RejectedRecordsError
+	if assert.ErrorAs(t, err, &rejected) {
+		assert.Len(t, rejected.Rejections, 1)
+		assert.Equal(t, readings[2], rejected.Rejections[0].Value)
+		assert.Equal(t, "table", rejected.Table)
+	}
+	assert.Len(t, client.WriteRequests(), 1, "rejections are not retried by default")
+}
+
+func TestWriterRejectionPolicy(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	client.FailWith(&types.RejectedRecordsException{RejectedRecords: []types.RejectedRecord{
+		{RecordIndex: 0, Reason: aws.String("retry me")},
+		{RecordIndex: 1, Reason: aws.String("drop me")},
+		{RecordIndex: 2, Reason: aws.String("dead letter me")},
+	}})
+
+	var deadLetters []timestream.Rejection
+	w := timestream.NewWriter(client, "database", fastRetries,
+		timestream.WithRejectionPolicy(func(r timestream.Rejection) timestream.RejectionAction {
+			switch r.Reason {
+			case "retry me":
+				return timestream.RejectionRetry
+			case "drop me":
+				return timestream.RejectionDrop
+			default:
+				return timestream.RejectionDeadLetter
+			}
+		}),
+		timestream.WithDeadLetter(func(_ context.Context, rejections []timestream.Rejection) {
+			deadLetters = append(deadLetters, rejections...)
+		}),
+	)
+	ctx := context.Background()
+
+	readings := newWriterReadings(3)
+	assert.NoError(t, w.Write(ctx, "table", readings))
+	assert.NoError(t, w.Close(ctx))
+
+	requests := client.WriteRequests()
+	if assert.Len(t, requests, 2) {
+		assert.Len(t, requests[1].Records, 1, "only the record to retry is sent again")
+		assert.Equal(t, fmt.Sprintf("%d", readings[0].Timestamp.UnixMilli()), *requests[1].Records[0].Time)
+	}
+	if assert.Len(t, deadLetters, 1) {
+		assert.Equal(t, readings[2], deadLetters[0].Value)
+	}
+}
+
+func TestWriterReportsRejectionsWhenFinalAttemptIsThrottled(t *testing.T) {
+	client := timestreamtest.NewFakeWriteClient()
+	throttled := &types.ThrottlingException{Message: aws.String("slow down")}
+	client.FailWith(
+		&types.RejectedRecordsException{RejectedRecords: []types.RejectedRecord{
+			{RecordIndex: 1, Reason: aws.String("Record timestamp is outside the memory store retention period")},
+		}},
+		throttled,
+		throttled,
+	)
+	w := timestream.NewWriter(client, "database", fastRetries,
+		timestream.WithRejectionPolicy(func(timestream.Rejection) timestream.RejectionAction { return timestream.RejectionRetry }),
+	)
+	ctx := context.Background()
+
+	readings := newWriterReadings(3)
+	assert.NoError(t, w.Write(ctx, "table", readings))
+	err := w.Close(ctx)
+
+	var throttling *types.ThrottlingException
+	assert.ErrorAs(t, err, &throttling)
+	var rejected *timestream.RejectedRecordsError
+	if assert.ErrorAs(t, err, &rejected) {
+		assert.Len(t, rejected.Rejections, 1)
+		assert.Equal(t, readings[1], rejected.Rejections[0].Value)
+	}
+	assert.Len(t, client.WriteRequests(), 3)
+}